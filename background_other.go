@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package process
+
+// setBackground sets whether the process with the specified pid runs with
+// background priority, which is only supported on linux and macOS.
+func setBackground(pid int, bg bool, restore int) (int, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,107 @@
+package process
+
+import (
+	"context"
+	"time"
+)
+
+// Diff compares two listings of the process table, such as from ListAll,
+// and returns the processes in after that aren't in before, which have
+// started, and those in before that aren't in after, which have exited.
+//
+// Processes are matched by their pid and Identity, so a pid that has been
+// reused by a new process between the listings is reported as both an exited
+// process and a started one. Identity only covers the fields that are set,
+// so for a listing from ListAll it's the pid and command that are compared.
+func Diff(before, after []*Process) (started, exited []*Process) {
+	beforeIDs := make(map[int]string, len(before))
+	for _, proc := range before {
+		beforeIDs[proc.Pid] = proc.Identity()
+	}
+	afterIDs := make(map[int]string, len(after))
+	for _, proc := range after {
+		afterIDs[proc.Pid] = proc.Identity()
+	}
+
+	for _, proc := range after {
+		if id, ok := beforeIDs[proc.Pid]; !ok || id != afterIDs[proc.Pid] {
+			started = append(started, proc)
+		}
+	}
+	for _, proc := range before {
+		if id, ok := afterIDs[proc.Pid]; !ok || id != beforeIDs[proc.Pid] {
+			exited = append(exited, proc)
+		}
+	}
+	return started, exited
+}
+
+// ProcEventKind describes whether a ProcEvent is for a process that has
+// been added to or removed from the process table.
+type ProcEventKind int
+
+const (
+	Added ProcEventKind = iota
+	Removed
+)
+
+// String returns a readable name for the kind.
+func (k ProcEventKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// ProcEvent is sent by WatchProcesses when a process is added to or removed
+// from the process table.
+type ProcEvent struct {
+	Kind ProcEventKind
+	Proc *Process
+}
+
+// WatchProcesses lists the process table every interval, as Stream does,
+// and sends an event on the returned channel for each process that has been
+// added or removed since the previous listing, as found by Diff, such as to
+// report each new process that's started. The channel is closed once ctx is
+// done.
+//
+// The first listing is only used to compare the next one against, so no
+// events are sent for the processes that are already running. A listing
+// that fails is skipped rather than being taken as every process having
+// been removed, and a process that starts and exits between two listings
+// isn't seen at all.
+func WatchProcesses(ctx context.Context, interval time.Duration) <-chan ProcEvent {
+	events := make(chan ProcEvent)
+	go func() {
+		defer close(events)
+		send := func(kind ProcEventKind, procs []*Process) bool {
+			for _, proc := range procs {
+				select {
+				case events <- ProcEvent{Kind: kind, Proc: proc}:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		var previous []*Process
+		first := true
+		for procs := range Stream(ctx, interval) {
+			if first {
+				previous, first = procs, false
+				continue
+			}
+			started, exited := Diff(previous, procs)
+			previous = procs
+			if !send(Added, started) || !send(Removed, exited) {
+				return
+			}
+		}
+	}()
+	return events
+}
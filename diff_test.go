@@ -0,0 +1,69 @@
+package process
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	before := []*Process{
+		{Process: &os.Process{Pid: 1}, Cmd: "init"},
+		{Process: &os.Process{Pid: 2}, Cmd: "exiting"},
+		{Process: &os.Process{Pid: 3}, Cmd: "reused"},
+	}
+	after := []*Process{
+		{Process: &os.Process{Pid: 1}, Cmd: "init"},
+		{Process: &os.Process{Pid: 3}, Cmd: "reusing"},
+		{Process: &os.Process{Pid: 4}, Cmd: "starting"},
+	}
+
+	started, exited := Diff(before, after)
+
+	expectedStarted := []string{"reusing", "starting"}
+	if len(started) != len(expectedStarted) {
+		t.Fatalf("expected %d started processes, found %d", len(expectedStarted), len(started))
+	}
+	for i, cmd := range expectedStarted {
+		if started[i].Cmd != cmd {
+			t.Errorf("started proc %d incorrect, expected %s, found %s", i, cmd, started[i].Cmd)
+		}
+	}
+
+	expectedExited := []string{"exiting", "reused"}
+	if len(exited) != len(expectedExited) {
+		t.Fatalf("expected %d exited processes, found %d", len(expectedExited), len(exited))
+	}
+	for i, cmd := range expectedExited {
+		if exited[i].Cmd != cmd {
+			t.Errorf("exited proc %d incorrect, expected %s, found %s", i, cmd, exited[i].Cmd)
+		}
+	}
+}
+
+func TestWatchProcesses(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := WatchProcesses(ctx, 50*time.Millisecond)
+
+	// Give the first listing time to be taken before starting the process.
+	time.Sleep(200 * time.Millisecond)
+	sleep := exec.Command("sleep", "5")
+	if err := sleep.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sleep.Process.Kill()
+
+	for event := range events {
+		if event.Kind == Added && event.Proc.Pid == sleep.Process.Pid {
+			cancel()
+			for range events {
+			}
+			return
+		}
+	}
+	t.Errorf("expected an added event for pid %d before the watch ended", sleep.Process.Pid)
+}
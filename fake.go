@@ -0,0 +1,131 @@
+package process
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// ProcessController is the set of methods used to control a process.
+//
+// *Process implements ProcessController, as does FakeProcess, so code that
+// supervises processes can be tested without starting real processes.
+type ProcessController interface {
+	HealthCheck() error
+	Signal(sig os.Signal) error
+	Kill() error
+	Start(detach bool, stdin io.Reader, stdout, stderr io.Writer,
+		notify chan<- struct{}) error
+	Wait() (*os.ProcessState, error)
+	String() string
+}
+
+var (
+	_ ProcessController = (*Process)(nil)
+	_ ProcessController = (*FakeProcess)(nil)
+)
+
+// FakeProcess is a ProcessController whose behaviour is scripted by it's
+// fields, for use in tests.
+type FakeProcess struct {
+	// Health is the sequence of errors returned by successive calls to
+	// HealthCheck. Once every error has been returned, the last error keeps
+	// being returned. If Health is empty, HealthCheck returns nil.
+	Health []error
+
+	// StartErr is returned by Start. If StartErr is nil, Start notifies
+	// on it's notify channel.
+	StartErr error
+
+	// State and WaitErr are returned by Wait.
+	State   *os.ProcessState
+	WaitErr error
+
+	mu           sync.Mutex
+	healthChecks int
+	killed       bool
+	signals      []os.Signal
+	starts       int
+}
+
+// HealthCheck returns the next error from Health, or ErrProcNotRunning once
+// the process has been killed by Kill.
+func (f *FakeProcess) HealthCheck() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.killed {
+		return ErrProcNotRunning
+	}
+	if len(f.Health) == 0 {
+		return nil
+	}
+
+	i := f.healthChecks
+	if i >= len(f.Health) {
+		i = len(f.Health) - 1
+	}
+	f.healthChecks++
+	return f.Health[i]
+}
+
+// Signal records sig.
+func (f *FakeProcess) Signal(sig os.Signal) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.signals = append(f.signals, sig)
+	return nil
+}
+
+// Kill records os.Kill and marks the process as no longer running.
+func (f *FakeProcess) Kill() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.signals = append(f.signals, os.Kill)
+	f.killed = true
+	return nil
+}
+
+// Start records that the process was started and returns StartErr.
+func (f *FakeProcess) Start(detach bool, stdin io.Reader, stdout, stderr io.Writer,
+	notify chan<- struct{}) error {
+	f.mu.Lock()
+	f.starts++
+	f.killed = false
+	f.mu.Unlock()
+
+	if f.StartErr != nil {
+		return f.StartErr
+	}
+
+	// Notify that the process has started if notify isn't nil.
+	if notify != nil {
+		notify <- struct{}{}
+	}
+	return nil
+}
+
+// Wait returns State and WaitErr.
+func (f *FakeProcess) Wait() (*os.ProcessState, error) {
+	return f.State, f.WaitErr
+}
+
+// String returns a description of the fake process.
+func (f *FakeProcess) String() string {
+	return "[Command]: fake\n"
+}
+
+// Signals returns every signal sent to the process by Signal and Kill,
+// in order.
+func (f *FakeProcess) Signals() []os.Signal {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]os.Signal(nil), f.signals...)
+}
+
+// Starts returns the number of times the process has been started.
+func (f *FakeProcess) Starts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.starts
+}
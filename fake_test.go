@@ -0,0 +1,55 @@
+package process
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFakeProcessHealth(t *testing.T) {
+	fake := &FakeProcess{
+		Health: []error{nil, nil, ErrProcNotRunning},
+	}
+
+	for i, expected := range []error{nil, nil, ErrProcNotRunning, ErrProcNotRunning} {
+		if err := fake.HealthCheck(); err != expected {
+			t.Errorf("health check %d incorrect, expected %v, found %v", i, expected, err)
+		}
+	}
+}
+
+func TestFakeProcessKill(t *testing.T) {
+	var proc ProcessController = &FakeProcess{}
+
+	if err := proc.HealthCheck(); err != nil {
+		t.Errorf("expected fake process to be healthy, found %v", err)
+	}
+
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Kill(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.HealthCheck(); err != ErrProcNotRunning {
+		t.Errorf("expected ErrProcNotRunning after kill, found %v", err)
+	}
+
+	signals := proc.(*FakeProcess).Signals()
+	if len(signals) != 2 || signals[0] != syscall.SIGTERM || signals[1] != os.Kill {
+		t.Errorf("signals incorrect, expected [%v %v], found %v",
+			syscall.SIGTERM, os.Kill, signals)
+	}
+
+	// Starting the process again makes it healthy.
+	notify := make(chan struct{}, 1)
+	if err := proc.Start(false, nil, nil, nil, notify); err != nil {
+		t.Fatal(err)
+	}
+	<-notify
+
+	if err := proc.HealthCheck(); err != nil {
+		t.Errorf("expected restarted fake process to be healthy, found %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package process
+
+import (
+	"context"
+	"errors"
+)
+
+// Group is a group of processes that are managed together, such as the
+// workers of a service.
+type Group []*Process
+
+// HealthCheckAll health checks every process in the group, carrying on when
+// a process is unhealthy. The returned error joins the error of each process
+// that isn't running, and is nil if every process is running.
+func (g Group) HealthCheckAll() error {
+	var errs []error
+	for _, proc := range g {
+		if err := proc.HealthCheck(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AliveSet returns which of the group's pids are running, from a single pass
+// over the process table rather than a health check of each process, which
+// is quicker for a large group.
+//
+// A zombie process isn't counted as running, like HealthCheck on linux.
+func (g Group) AliveSet() (map[int]bool, error) {
+	alive := make(map[int]bool, len(g))
+	for _, proc := range g {
+		alive[proc.Pid] = false
+	}
+
+	err := forEach(context.Background(), snapshotFormat, parseSnapshotLine, func(proc *Process) error {
+		if _, ok := alive[proc.Pid]; ok && proc.RunState != StateZombie {
+			alive[proc.Pid] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alive, nil
+}
@@ -0,0 +1,46 @@
+package process
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestAliveSet(t *testing.T) {
+	running := &Process{Cmd: "sleep", Args: []string{"5"}}
+	notify := make(chan struct{})
+	go running.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer running.Kill()
+
+	// A child that has exited but isn't waited on is a zombie.
+	zombieCmd := exec.Command("true")
+	if err := zombieCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer zombieCmd.Wait()
+	zombie := &Process{Process: zombieCmd.Process}
+	waitZombie(zombie)
+
+	exitedCmd := exec.Command("true")
+	if err := exitedCmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exited := &Process{Process: exitedCmd.Process}
+
+	group := Group{running, zombie, exited}
+	alive, err := group.AliveSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, proc := range group {
+		// HealthCheck only reports zombies as not running on linux.
+		healthy := proc.HealthCheck() == nil && proc != zombie
+		if alive[proc.Pid] != healthy {
+			t.Errorf("proc %d alive incorrect, expected %v, found %v", proc.Pid, healthy, alive[proc.Pid])
+		}
+	}
+	if !alive[running.Pid] {
+		t.Errorf("expected running proc %d to be alive", running.Pid)
+	}
+}
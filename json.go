@@ -0,0 +1,109 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// processJSON is the JSON form of a Process.
+type processJSON struct {
+	Pid        int        `json:"pid"`
+	PPid       int        `json:"ppid,omitempty"`
+	Pgid       int        `json:"pgid,omitempty"`
+	Sid        int        `json:"sid,omitempty"`
+	UID        int        `json:"uid"`
+	Tty        string     `json:"tty,omitempty"`
+	Cwd        string     `json:"cwd,omitempty"`
+	Cmd        string     `json:"cmd"`
+	Args       []string   `json:"args,omitempty"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	State      string     `json:"state,omitempty"`
+	RSS        uint64     `json:"rss,omitempty"`
+	CPUPercent float64    `json:"cpu_percent,omitempty"`
+}
+
+// MarshalJSON encodes the process's pid and the fields found for it, such as
+// it's cmd, args and resource usage, as a JSON object. The fields that are
+// only used to start the process, such as it's Env, aren't encoded.
+func (p *Process) MarshalJSON() ([]byte, error) {
+	pj := processJSON{
+		UID:        p.UID,
+		PPid:       p.PPid,
+		Pgid:       p.PGID,
+		Sid:        p.SID,
+		Tty:        p.Tty,
+		Cwd:        p.Cwd,
+		Cmd:        p.Cmd,
+		Args:       p.Args,
+		RSS:        p.RSS,
+		CPUPercent: p.CPUPercent,
+	}
+	if p.Process != nil {
+		pj.Pid = p.Pid
+	}
+	if !p.StartTime.IsZero() {
+		pj.StartTime = &p.StartTime
+	}
+	if p.RunState != 0 {
+		pj.State = string(p.RunState)
+	}
+	return json.Marshal(pj)
+}
+
+// UnmarshalJSON decodes a process encoded by MarshalJSON, finding the
+// process by it's pid.
+func (p *Process) UnmarshalJSON(data []byte) error {
+	var pj processJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+
+	proc, err := os.FindProcess(pj.Pid)
+	if err != nil {
+		return err
+	}
+
+	p.Process = proc
+	p.PPid = pj.PPid
+	p.PGID = pj.Pgid
+	p.SID = pj.Sid
+	p.UID = pj.UID
+	p.Tty = pj.Tty
+	p.Cwd = pj.Cwd
+	p.Cmd = pj.Cmd
+	p.Args = pj.Args
+	p.StartTime = time.Time{}
+	if pj.StartTime != nil {
+		p.StartTime = *pj.StartTime
+	}
+	p.RunState = 0
+	if pj.State != "" {
+		p.RunState = State(pj.State[0])
+	}
+	p.RSS = pj.RSS
+	p.CPUPercent = pj.CPUPercent
+	return nil
+}
+
+// WriteJSONLines writes each of procs to w as a JSON object on it's own line,
+// such as for piping a Snapshot into jq. If w has a Flush method, such as a
+// *bufio.Writer, it's flushed once every process has been written.
+func WriteJSONLines(w io.Writer, procs []*Process) error {
+	for _, proc := range procs {
+		line, err := json.Marshal(proc)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("error: writing process %d: %w", proc.Pid, err)
+		}
+	}
+
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
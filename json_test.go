@@ -0,0 +1,103 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONLines(t *testing.T) {
+	procs := []*Process{
+		{
+			Process:   &os.Process{Pid: 4242},
+			PPid:      1,
+			PGID:      4240,
+			SID:       4200,
+			Tty:       "pts/0",
+			Cmd:       "sleep",
+			Args:      []string{"5", "with space"},
+			StartTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			RunState:  StateSleeping,
+			RSS:       4096,
+		},
+		{Process: &os.Process{Pid: 4243}, Cmd: "other"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSONLines(&buf, procs); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	var i int
+	for ; scanner.Scan(); i++ {
+		if i >= len(procs) {
+			t.Fatalf("expected %d lines, found more", len(procs))
+		}
+
+		var proc Process
+		if err := json.Unmarshal(scanner.Bytes(), &proc); err != nil {
+			t.Fatal(err)
+		}
+
+		want := procs[i]
+		if proc.Pid != want.Pid || proc.PPid != want.PPid || proc.PGID != want.PGID ||
+			proc.SID != want.SID || proc.Tty != want.Tty ||
+			proc.Cmd != want.Cmd || len(proc.Args) != len(want.Args) ||
+			!proc.StartTime.Equal(want.StartTime) || proc.RunState != want.RunState ||
+			proc.RSS != want.RSS {
+			t.Errorf("line %d incorrect, expected %+v, found %+v", i, want, &proc)
+		}
+	}
+	if i != len(procs) {
+		t.Errorf("expected %d lines, found %d", len(procs), i)
+	}
+}
+
+func TestMarshalJSONPgidSid(t *testing.T) {
+	pgid, err := syscall.Getpgid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := getsid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := FindByPidFast(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.PGID != pgid || proc.SID != sid {
+		t.Errorf("proc pgid and sid incorrect, expected %d and %d, found %d and %d",
+			pgid, sid, proc.PGID, proc.SID)
+	}
+
+	data, err := json.Marshal(proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["pgid"] != float64(pgid) {
+		t.Errorf("pgid incorrect, expected %d, found %v", pgid, fields["pgid"])
+	}
+	if fields["sid"] != float64(sid) {
+		t.Errorf("sid incorrect, expected %d, found %v", sid, fields["sid"])
+	}
+
+	str := proc.String()
+	for _, line := range []string{fmt.Sprintf("[Pgid]: %d\n", pgid), fmt.Sprintf("[Sid]: %d\n", sid)} {
+		if !strings.Contains(str, line) {
+			t.Errorf("expected String to contain %q, found %q", line, str)
+		}
+	}
+}
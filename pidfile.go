@@ -0,0 +1,56 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// WritePidFile writes the process's pid to the file at path, replacing any
+// existing file atomically, so that a reader never sees a partly written
+// pid.
+func (p *Process) WritePidFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(strconv.Itoa(p.Pid) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// FromPidFile reads a pid from the file at path and returns the process with
+// that pid, found the same as by FindByPid.
+//
+// If the pid file is stale, since the process isn't running any more,
+// ErrProcNotRunning is returned. A process's pid can be reused once it exits,
+// so a caller that knows which command should be running can check the
+// Process's Cmd or use VerifyIdentity before trusting it.
+func FromPidFile(path string) (*Process, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := parsePid(string(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	if !Exists(pid) {
+		return nil, &ProcError{Op: "frompidfile", Pid: pid, Err: ErrProcNotRunning}
+	}
+
+	return FindByPid(pid)
+}
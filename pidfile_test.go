@@ -0,0 +1,43 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pid")
+
+	self := &Process{Process: &os.Process{Pid: pid}}
+	if err := self.WritePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := FromPidFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != pid {
+		t.Errorf("proc pid incorrect, expected %d, found %d", pid, proc.Pid)
+	}
+}
+
+func TestPidFileStale(t *testing.T) {
+	c := exec.Command("true")
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "stale.pid")
+	exited := &Process{Process: c.Process}
+	if err := exited.WritePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FromPidFile(path); !errors.Is(err, ErrProcNotRunning) {
+		t.Errorf("expected ErrProcNotRunning, found %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package process
+
+import "time"
+
+// PollConfig describes how often a process is checked on whilst waiting for
+// it to change, such as waiting for it to exit. The first check is made
+// straight away, the second after Initial, and each interval after that is
+// Multiplier times the previous one, up to Max, so that a quick change is
+// seen quickly but a long wait doesn't keep checking in a tight loop.
+type PollConfig struct {
+	// Initial is the interval between the first and second checks. It must
+	// be greater than 0.
+	Initial time.Duration
+
+	// Max is the longest interval between checks. If Max is 0, the interval
+	// grows without a limit.
+	Max time.Duration
+
+	// Multiplier is how much the interval grows by after each check. If
+	// Multiplier is 1 or less, every interval is Initial.
+	Multiplier float64
+}
+
+// DefaultPollConfig is used by every function that polls a process that
+// wasn't started by this package without being given an interval, which are
+// KillAndWait, Done, WaitAny, WaitExitPidfd, ReloadAndWait and RestartWith.
+// It can be changed to trade how soon a change is seen for how much checking
+// is done.
+//
+// The functions that are given how often to poll keep to exactly what
+// they're given instead, which are FindProcessRetry and StartTty, with
+// StartTtyAttempts and StartTtyInterval, and the sampling functions such as
+// WatchMemory, WaitMemoryExceeds, WaitForIdle and EnforceCPUBudget, whose
+// samples are only comparable when they're taken at a fixed interval.
+var DefaultPollConfig = PollConfig{
+	Initial:    10 * time.Millisecond,
+	Max:        500 * time.Millisecond,
+	Multiplier: 2,
+}
+
+// backoff returns a function that returns the next interval to wait for
+// each time it's called, starting at c.Initial.
+func (c PollConfig) backoff() func() time.Duration {
+	next := c.Initial
+	return func() time.Duration {
+		interval := next
+		if c.Multiplier > 1 && (c.Max == 0 || next < c.Max) {
+			next = time.Duration(float64(next) * c.Multiplier)
+		}
+		if c.Max > 0 && next > c.Max {
+			next = c.Max
+		}
+		return interval
+	}
+}
+
+// after is time.After, which is a variable so that tests can record the
+// intervals that are waited for.
+var after = time.After
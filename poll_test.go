@@ -0,0 +1,90 @@
+package process
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollConfigBackoff(t *testing.T) {
+	tests := []struct {
+		cfg       PollConfig
+		intervals []time.Duration
+	}{
+		{
+			PollConfig{Initial: 10, Max: 50, Multiplier: 2},
+			[]time.Duration{10, 20, 40, 50, 50},
+		},
+		{
+			PollConfig{Initial: 10, Multiplier: 3},
+			[]time.Duration{10, 30, 90, 270, 810},
+		},
+		{
+			PollConfig{Initial: 10, Max: 50, Multiplier: 1},
+			[]time.Duration{10, 10, 10, 10, 10},
+		},
+	}
+
+	for _, test := range tests {
+		next := test.cfg.backoff()
+		var intervals []time.Duration
+		for range test.intervals {
+			intervals = append(intervals, next())
+		}
+		if !reflect.DeepEqual(intervals, test.intervals) {
+			t.Errorf("intervals for %+v incorrect, expected %v, found %v",
+				test.cfg, test.intervals, intervals)
+		}
+	}
+}
+
+func TestPollConfigWaitGone(t *testing.T) {
+	sleep := exec.Command("sleep", "5")
+	if err := sleep.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sleep.Process.Kill()
+	proc := &Process{Process: sleep.Process}
+
+	defaultPollConfig := DefaultPollConfig
+	defer func() {
+		DefaultPollConfig = defaultPollConfig
+		after = time.After
+	}()
+	DefaultPollConfig = PollConfig{
+		Initial:    10 * time.Millisecond,
+		Max:        50 * time.Millisecond,
+		Multiplier: 2,
+	}
+
+	// Record each interval without waiting for it, and kill the process
+	// once enough intervals have been recorded.
+	var intervals []time.Duration
+	after = func(d time.Duration) <-chan time.Time {
+		intervals = append(intervals, d)
+		if len(intervals) == 5 {
+			sleep.Process.Kill()
+			sleep.Wait()
+		}
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+
+	if err := proc.waitGone(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(intervals, expected) {
+		t.Errorf("intervals incorrect, expected %v, found %v", expected, intervals)
+	}
+}
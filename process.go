@@ -3,13 +3,21 @@ package process
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 	"unicode"
 	"unsafe"
 )
@@ -19,6 +27,10 @@ var (
 	// for a Process and the Process's command is empty.
 	ErrProcCommandEmpty = fmt.Errorf("error: process command is empty")
 
+	// ErrProcNotFound is an error that occurs when calling FindProcess
+	// for a Process and no process matches the Process's command and tty.
+	ErrProcNotFound = fmt.Errorf("error: process not found")
+
 	// ErrProcNotRunning is an error that is returned when running a health check
 	// for a process and the process is not running.
 	ErrProcNotRunning = fmt.Errorf("error: process is not running")
@@ -28,25 +40,238 @@ var (
 	ErrProcNotInTty = fmt.Errorf("process is not in a tty")
 
 	// ErrInvalidNumber is an error that occurs when the number scanned in
-	// whilst searching for a ProcessByName is less than 0.
+	// whilst searching for a ProcessByName isn't one of the listed numbers.
 	ErrInvalidNumber = fmt.Errorf("please enter a valid number")
+
+	// ErrProcClosed is an error that occurs when waiting for a Process to
+	// exit and the Process is closed by Close.
+	ErrProcClosed = fmt.Errorf("error: process is closed")
+
+	// ErrRestartTimeout is an error that occurs when a Process is started by
+	// StartTty but the started process never shows up in ps.
+	ErrRestartTimeout = fmt.Errorf("error: timed out waiting for process to restart")
+
+	// ErrIdentityMismatch is an error that occurs when verifying a Process's
+	// identity and the command running at the Process's pid is no longer
+	// the Process's command, such as after the pid has been reused.
+	ErrIdentityMismatch = fmt.Errorf("error: process identity does not match pid")
+
+	// ErrUnsupported is an error that occurs when calling a function that
+	// isn't supported on the current platform.
+	ErrUnsupported = fmt.Errorf("error: operation not supported on this platform")
+
+	// ErrHealthCheckFailed is an error that occurs when the command run by
+	// HealthCheckCmd to check a Process's health exits unsuccessfully.
+	ErrHealthCheckFailed = fmt.Errorf("error: health check command failed")
+
+	// ErrCmdNotStarted is an error that occurs when creating a Process from
+	// an *exec.Cmd that hasn't been started.
+	ErrCmdNotStarted = fmt.Errorf("error: command has not been started")
+
+	// ErrProcNotChild is an error that occurs when reaping a Process that
+	// isn't a child of the current process.
+	ErrProcNotChild = fmt.Errorf("error: process is not a child of this process")
+
+	// ErrProcReaped is an error that occurs when reaping a Process that has
+	// already been reaped by Reap.
+	ErrProcReaped = fmt.Errorf("error: process has already been reaped")
+
+	// ErrStopIteration is an error that can be returned by the function passed
+	// to Each to stop iterating over the process table without Each failing.
+	ErrStopIteration = fmt.Errorf("error: stop iteration")
+
+	// ErrKillTimeout is an error that occurs when a Process is killed by
+	// KillAndWait but it's still running once the timeout has elapsed.
+	ErrKillTimeout = fmt.Errorf("error: timed out waiting for killed process to exit")
+
+	// ErrProcNoPipes is an error that occurs when reading a Process's stdout
+	// by StdoutReader but the Process wasn't started by StartPipes.
+	ErrProcNoPipes = fmt.Errorf("error: process was not started by StartPipes, use StartPipes to read it's stdout")
+
+	// ErrInvalidOOMScoreAdj is an error that occurs when setting a Process's
+	// oom score adjustment to a value outside of -1000 to 1000.
+	ErrInvalidOOMScoreAdj = fmt.Errorf("error: oom score adjustment must be between -1000 and 1000")
+
+	// ErrProtectedPid is an error that occurs when signalling init, the
+	// current process or it's parent whilst ProtectCriticalPids is set.
+	ErrProtectedPid = fmt.Errorf("error: refusing to signal a protected pid")
+
+	// ErrReloadTimeout is an error that occurs when a Process is reloaded by
+	// ReloadAndWait but it's readiness probe doesn't succeed in time.
+	ErrReloadTimeout = fmt.Errorf("error: timed out waiting for process to reload")
+
+	// ErrNoScript is an error that occurs when finding the script run by a
+	// Process's interpreter but none of it's args is a script.
+	ErrNoScript = fmt.Errorf("error: process has no script argument")
 )
 
+// execCommand returns the *exec.Cmd used to run the ps and lsof commands
+// whose output is parsed to find processes. It's a variable so that tests
+// can replace it to feed canned output to the parsers.
+var execCommand = exec.Command
+
+// Logf, when set, is called to log each ps and lsof command that's run, how
+// long it took and the outcome of parsing it's output, which helps to find
+// out why a lookup is slow or wrong. Logf is nil by default, so nothing is
+// logged.
+var Logf func(format string, args ...interface{})
+
+// ArgParser is used to parse a process's args from it's full command, as
+// reported by ps's command field, and it's comm. It can be replaced for
+// systems where the built-in parsing doesn't work, or wrapped to adjust the
+// args that the built-in parser returns.
+//
+// While ArgParser is the built-in parser, the args are read exactly from
+// /proc on linux instead of being parsed from the command. Once wrapped, the
+// built-in parser parses the command on linux too. If ArgParser is set to
+// nil, the built-in parser is used.
+var ArgParser = defaultArgParser
+
+// defaultArgParser is the built-in ArgParser, which parses the args that
+// follow the comm in the command with commandArgs.
+func defaultArgParser(command, comm string) []string {
+	return commandArgs(command, comm)
+}
+
+// ProtectCriticalPids, when set, stops Signal, Kill and SignalTree from
+// signalling init (pid 1), the current process or it's parent, returning
+// ErrProtectedPid instead, so that a bad pid in bulk tooling can't take down
+// the system or the tool itself. Signal 0, which only checks that a process
+// exists, is still allowed. ProtectCriticalPids is set by default.
+var ProtectCriticalPids = true
+
+// StartTtyAttempts and StartTtyInterval are how many times and how often
+// StartTty looks for the process it started in ps before giving up.
+var (
+	StartTtyAttempts = 20
+	StartTtyInterval = 100 * time.Millisecond
+)
+
+// killWaitTimeout is how long RestartWith waits for a killed process to be
+// gone before giving up on restarting it.
+const killWaitTimeout = 10 * time.Second
+
+// ProcError records an error along with the operation and the pid of the
+// process that caused it.
+//
+// The underlying error is available through Unwrap, so sentinel errors such
+// as ErrProcNotRunning can still be checked for by using errors.Is.
+type ProcError struct {
+	Op  string
+	Pid int
+	Err error
+}
+
+// Error returns the error's operation, pid and underlying error as a string.
+func (e *ProcError) Error() string {
+	return fmt.Sprintf("%s %d: %v", e.Op, e.Pid, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ProcError) Unwrap() error {
+	return e.Err
+}
+
 // Process describes a unix process.
 //
-// The Process's Pid and the methods Kill(), Release(), Signal()
-// and Wait() are implemented by composition with os.Process.
+// The Process's Pid and the methods Release() and Wait() are implemented
+// by composition with os.Process. Kill() and Signal() wrap their os.Process
+// counterparts so that any error returned is a *ProcError.
+//
+// A Process holds a mutex, so it must not be copied after first use. Pass
+// a *Process around instead.
 type Process struct {
 	*os.Process
+	UID  int
 	Tty  string
 	Cwd  string
 	Cmd  string
 	Args []string
+
+	// StartTime is the time that the process started.
+	StartTime time.Time
+
+	// PPid, RunState, RSS and CPUPercent are only set by FindByPidFields.
+	PPid       int
+	RunState   State
+	RSS        uint64
+	CPUPercent float64
+
+	// PGID and SID are the process group and session ids of the process at
+	// the time it was found, such as by FindByPid or Snapshot. Unlike Pgid
+	// and Sid, they aren't looked up again, so they still describe the
+	// process once it has exited and it's pid has been reused.
+	PGID int
+	SID  int
+
+	// Chroot, if set, is the root directory that the process is started in
+	// by Start. Changing the root directory requires root privileges.
+	Chroot string
+
+	// Credential, if set, is the user and group ids that the process is
+	// started as by Start. Starting a process as another user requires
+	// root privileges.
+	Credential *syscall.Credential
+
+	// Env is the environment of the process when it's started by Start or
+	// run by RunWithInput, in the form "key=value". If Env is nil, the
+	// process uses the current process's environment.
+	Env []string
+
+	// ExtraFiles are open files passed to the process when it's started by
+	// Start, StartWith or StartPipes, such as a listening socket being
+	// handed off to it. Entry i becomes file descriptor 3+i in the process.
+	ExtraFiles []*os.File
+
+	// Umask, if set, is the file mode creation mask of the process when
+	// it's started by Start, StartWith or StartPipes, of which only the
+	// permission bits are used.
+	//
+	// Go can't set a child's umask directly, so the process is started by
+	// sh, which sets the umask and then execs the process's command in it's
+	// place, keeping the same pid. The command is looked up in the PATH
+	// first, the same as without a Umask, and sh is passed it's path. This requires sh to be found in the PATH,
+	// or inside the root directory when Chroot is also set.
+	Umask *int
+
+	// child is set when the process was started by Start or StartPipes.
+	child *child
+
+	// mu guards closed, which is closed by Close, reaped, which is set by
+	// Reap, and nice, the nice value to restore on linux once SetBackground
+	// is called with false.
+	mu     sync.Mutex
+	closed chan struct{}
+	reaped bool
+	nice   *int
+}
+
+// child holds the state of a process that was started by Start or
+// StartPipes.
+type child struct {
+	// done is closed once the process has exited and state is set.
+	done  chan struct{}
+	state *os.ProcessState
+
+	// pipes holds the pipes connected to the process by StartPipes, of
+	// which stdout is the one connected to it's stdout.
+	pipes  []io.Closer
+	stdout io.Reader
+}
+
+// wait waits for c to exit and records it's final state.
+func (ch *child) wait(c *exec.Cmd) error {
+	err := c.Wait()
+	ch.state = c.ProcessState
+	close(ch.done)
+	return err
 }
 
 // String returns all of the process's relevant information as a string.
+//
+// The process's PGID and SID are only included if they were found.
 func (p *Process) String() string {
-	return fmt.Sprintf("[Pid]: %d\n"+
+	s := fmt.Sprintf("[Pid]: %d\n"+
 		"[Command]: %s\n"+
 		"[Args]: %s\n"+
 		"[Cwd]: %v\n"+
@@ -57,270 +282,2348 @@ func (p *Process) String() string {
 		p.Cwd,
 		p.Tty,
 	)
+	if p.PGID != 0 {
+		s += fmt.Sprintf("[Pgid]: %d\n", p.PGID)
+	}
+	if p.SID != 0 {
+		s += fmt.Sprintf("[Sid]: %d\n", p.SID)
+	}
+	return s
 }
 
 // HealthCheck signals the process to see if it's still running.
+//
+// A zombie process can still be signalled, but it has already exited and is
+// only waiting to be reaped by it's parent. On linux, where the process's
+// state is cheaply read from /proc, a zombie is reported as not running.
+// Elsewhere reading the state would run ps on every health check, so a
+// zombie is reported as running.
 func (p *Process) HealthCheck() error {
-	if err := p.Signal(syscall.Signal(0)); err != nil {
-		return ErrProcNotRunning
+	if err := p.Process.Signal(syscall.Signal(0)); err != nil || isZombie(p.Pid) {
+		return &ProcError{Op: "healthcheck", Pid: p.Pid, Err: ErrProcNotRunning}
 	}
 	return nil
 }
 
-// Start starts a process and notifies on the notify channel
-// when the process has been started. It uses stdin, stdout and
-// stderr for the command's stdin, stdout and stderr respectively.
+// HealthCheckCmd runs the command name with the specified args to check
+// whether the process is healthy, such as a service's own health check
+// command, rather than just whether it's running like HealthCheck.
 //
-// If the notify channel is nil, just return normally so the call doesn't block.
-func (p *Process) Start(detach bool, stdin io.Reader, stdout, stderr io.Writer,
-	notify chan<- struct{}) error {
-	// Create a new command to start the process with.
-	c := exec.Command(p.Cmd, p.Args...)
-	c.Stdin = stdin
-	c.Stdout = stdout
-	c.Stderr = stderr
-
-	if p.InTty() {
-		// Start the process in a different process group if detach is set to true.
-		c.SysProcAttr = &syscall.SysProcAttr{Setpgid: detach}
-	} else {
-		// If process didn't start in a tty and detach is true, disconnect
-		// process from any tty.
-		c.SysProcAttr = &syscall.SysProcAttr{Setsid: detach}
+// If the command exits unsuccessfully, the returned error wraps
+// ErrHealthCheckFailed along with the command's exit error and output.
+func (p *Process) HealthCheckCmd(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return &ProcError{Op: "healthcheckcmd", Pid: p.Pid, Err: fmt.Errorf("%w: %s: %v: %s",
+			ErrHealthCheckFailed, name, err, bytes.TrimSpace(out))}
 	}
+	return nil
+}
 
-	// Start the command.
-	if err := c.Start(); err != nil {
-		return err
+// Signal sends a signal to the process.
+func (p *Process) Signal(sig os.Signal) error {
+	if sig != syscall.Signal(0) && protectedPid(p.Pid) {
+		return &ProcError{Op: "signal", Pid: p.Pid, Err: ErrProtectedPid}
 	}
-
-	// Notify that the process has started if notify isn't nil.
-	if notify != nil {
-		notify <- struct{}{}
+	if err := p.Process.Signal(sig); err != nil {
+		return &ProcError{Op: "signal", Pid: p.Pid, Err: err}
 	}
-
-	// Wait for the command to finish.
-	return c.Wait()
+	return nil
 }
 
-// StartTty requires sudo to work.
-//
-// StartTty starts a process in a tty and notifies on the notify channel
-// when the process has been started.
-//
-// If the notify channel is nil, just return normally so the call doesn't block.
-//
-// The notify channel is here for consistency with the notify channel from
-// the Start method.
-func (p *Process) StartTty(ttyFd uintptr, notify chan<- struct{}) error {
-	// Append a new line character to the full command so the command
-	// actually executes.
-	fullCommandNL := p.FullCommand() + "\n"
-
-	// Write each byte from fullCommandNL to the tty instance.
-	var eno syscall.Errno
-	for _, b := range fullCommandNL {
-		_, _, eno = syscall.Syscall(syscall.SYS_IOCTL,
-			ttyFd,
-			syscall.TIOCSTI,
-			uintptr(unsafe.Pointer(&b)),
-		)
-		if eno != 0 {
-			return error(eno)
+// SignalAll sends a signal to each of procs, carrying on when signalling a
+// process fails. The returned error joins the *ProcError of each process that
+// couldn't be signalled, which records it's pid, and is nil if every process
+// was signalled.
+func SignalAll(procs []*Process, sig syscall.Signal) error {
+	var errs []error
+	for _, proc := range procs {
+		if err := proc.Signal(sig); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
 
-	// Get the new PID of the restarted process.
-	if err := p.FindProcess(); err != nil {
-		return err
-	}
+// protectedPid reports whether ProtectCriticalPids stops pid from being
+// signalled.
+func protectedPid(pid int) bool {
+	return ProtectCriticalPids && (pid == 1 || pid == os.Getpid() || pid == os.Getppid())
+}
 
-	// Notify that the process has started if notify isn't nil.
-	if notify != nil {
-		notify <- struct{}{}
+// Kill causes the process to exit immediately.
+func (p *Process) Kill() error {
+	if protectedPid(p.Pid) {
+		return &ProcError{Op: "kill", Pid: p.Pid, Err: ErrProtectedPid}
+	}
+	if err := p.Process.Kill(); err != nil {
+		return &ProcError{Op: "kill", Pid: p.Pid, Err: err}
 	}
-
 	return nil
 }
 
-// FindProcess finds and then sets a Process's process based
-// on it's command, it's command's arguments and it's tty.
-func (p *Process) FindProcess() error {
-	if p.Process == nil {
-		p.Process = &os.Process{}
+// SignalTree sends a signal to every descendant of the process, found from
+// the PPid of each process in a single ListAll, and then to the process
+// itself. Descendants are signalled leaf first, so that a parent isn't
+// signalled before it's children.
+//
+// A descendant that exits before it's signalled is skipped, as is a
+// descendant that's protected by ProtectCriticalPids, such as the current
+// process. Every process is signalled even if signalling one of them fails,
+// and the first error is returned.
+func (p *Process) SignalTree(sig syscall.Signal) error {
+	if sig != 0 && protectedPid(p.Pid) {
+		return &ProcError{Op: "signaltree", Pid: p.Pid, Err: ErrProtectedPid}
 	}
 
-	if p.Cmd == "" {
-		return ErrProcCommandEmpty
+	procs, err := ListAll()
+	if err != nil {
+		return &ProcError{Op: "signaltree", Pid: p.Pid, Err: err}
 	}
 
-	ps, err := exec.Command("ps", "-e").Output()
-	if err != nil {
-		return err
+	children := make(map[int][]*Process)
+	for _, proc := range procs {
+		children[proc.PPid] = append(children[proc.PPid], proc)
 	}
 
-	scanner := bufio.NewScanner(bytes.NewReader(ps))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, p.Cmd) && strings.Contains(line, p.Tty) {
-			p.Pid, err = strconv.Atoi(strings.TrimSpace(
-				strings.FieldsFunc(line, unicode.IsSpace)[0]),
-			)
-			if err != nil {
-				return err
+	var firstErr error
+	var signalDescendants func(pid int)
+	signalDescendants = func(pid int) {
+		for _, child := range children[pid] {
+			signalDescendants(child.Pid)
+			if sig != 0 && protectedPid(child.Pid) {
+				continue
+			}
+			err := child.Process.Signal(sig)
+			if err != nil && !errors.Is(err, os.ErrProcessDone) &&
+				!errors.Is(err, syscall.ESRCH) && firstErr == nil {
+				firstErr = &ProcError{Op: "signaltree", Pid: child.Pid, Err: err}
 			}
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return err
-	}
+	signalDescendants(p.Pid)
 
-	// Reset p.Process to the new process found from the new pid.
-	p.Process, err = os.FindProcess(p.Pid)
-	return err
+	if err := p.Process.Signal(sig); err != nil && firstErr == nil {
+		firstErr = &ProcError{Op: "signaltree", Pid: p.Pid, Err: err}
+	}
+	return firstErr
 }
 
-// FullCommand returns a string containing the process's
-// cmd and any args that it has joined to it by a space.
+// KillAndWait kills the process and then waits for up to timeout for it to
+// be gone, unlike Kill which returns as soon as the signal is sent. If the
+// process is still running after timeout, ErrKillTimeout is returned.
 //
-// If there are no args, FullCommand returns just the cmd.
-func (p *Process) FullCommand() string {
-	if len(p.Args) == 0 {
-		return p.Cmd
+// A process started by Start is waited on until it's reaped, otherwise the
+// process is health checked as often as DefaultPollConfig describes until
+// it's no longer running, or on linux is a zombie.
+func (p *Process) KillAndWait(timeout time.Duration) error {
+	if err := p.Kill(); err != nil {
+		return err
 	}
-	return fmt.Sprintf("%s %s", p.Cmd, strings.Join(p.Args, " "))
-}
 
-// InTty returns a true or false depending if p.Tty is ?? or
-// a value such as ttys001.
-func (p *Process) InTty() bool {
-	return p.Tty != "??"
-}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-// OpenTty returns an opened file handle to the tty of the process.
-func (p *Process) OpenTty() (*os.File, error) {
-	if !p.InTty() {
-		return nil, ErrProcNotInTty
+	var err error
+	if p.child != nil {
+		select {
+		case <-p.child.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	} else {
+		err = p.waitGone(ctx)
 	}
-	return os.Open("/dev/" + p.Tty)
-}
 
-// Chdir changes the current working directory to the processes cwd.
-func (p *Process) Chdir() error {
-	return os.Chdir(p.Cwd)
+	if err == context.DeadlineExceeded {
+		err = ErrKillTimeout
+	}
+	if err != nil {
+		return &ProcError{Op: "killandwait", Pid: p.Pid, Err: err}
+	}
+	return nil
 }
 
-// Find by name takes in a name and through a process of elimination by
-// prompting the user to select the correct process from a list, finds
-// and returns a process by it's name.
+// VerifyIdentity checks that the command currently running at the process's
+// pid still matches the process's command and args, to guard against the pid
+// having been reused by another program since the process was found.
 //
-// FindByName writes the list of names to the specified stdout and then scans
-// the number for choosing the correct name from the specified stdin.
-func FindByName(stdout io.Writer, stdin io.Reader, name string) (*Process, error) {
-	psOutput, err := exec.Command("ps", "-e").Output()
+// The commands are compared by their base names, since ps reports only the
+// executable's name, truncated to 15 bytes, on linux, and the full path
+// elsewhere. The args are only compared if the process has any args set.
+// If the process has it's StartTime set, such as by FindByPid, the start
+// times are compared too, which tells apart a new process running the same
+// command at a reused pid.
+//
+// Call VerifyIdentity before signalling a process that may have exited long
+// ago to avoid signalling an innocent process.
+func (p *Process) VerifyIdentity() error {
+	fields := []string{"comm"}
+	if !p.StartTime.IsZero() {
+		fields = append(fields, "lstart")
+	}
+	current, err := findByPidFields(p.Pid, fields...)
 	if err != nil {
-		return nil, err
+		return &ProcError{Op: "verifyidentity", Pid: p.Pid, Err: err}
 	}
-	lowercaseOutput := bytes.ToLower(psOutput)
 
-	var names []string
-	scanner := bufio.NewScanner(bytes.NewReader(lowercaseOutput))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, name) {
-			names = append(names, line)
-		}
+	if !commMatches(current.Cmd, p.Cmd) {
+		return &ProcError{Op: "verifyidentity", Pid: p.Pid, Err: ErrIdentityMismatch}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+
+	// ps only reports start times to the second.
+	if !p.StartTime.IsZero() &&
+		!current.StartTime.Truncate(time.Second).Equal(p.StartTime.Truncate(time.Second)) {
+		return &ProcError{Op: "verifyidentity", Pid: p.Pid, Err: ErrIdentityMismatch}
 	}
 
-	// Display a list of all the found names.
-	for i, name := range names {
-		fmt.Printf("%d: %s\n", i, name)
+	if len(p.Args) == 0 {
+		return nil
 	}
 
-	procNumber := -1
-	fmt.Fprintln(stdout, "\nWhich number above represents the correct process (enter the number):")
-	fmt.Fscanf(stdin, "%d", &procNumber)
+	args, err := readArgs(p.Pid, current.Cmd)
+	if err != nil {
+		return &ProcError{Op: "verifyidentity", Pid: p.Pid, Err: err}
+	}
+	if strings.Join(args, "\x00") != strings.Join(p.Args, "\x00") {
+		return &ProcError{Op: "verifyidentity", Pid: p.Pid, Err: ErrIdentityMismatch}
+	}
 
-	if procNumber < 0 {
-		return nil, ErrInvalidNumber
+	return nil
+}
+
+// commMaxLen is the length that linux truncates a process's comm to.
+const commMaxLen = 15
+
+// commMatches reports whether comm, as reported by ps, is the comm of a
+// process whose command is cmd, which may be a path or a name longer than
+// commMaxLen.
+func commMatches(comm, cmd string) bool {
+	comm, cmd = filepath.Base(comm), filepath.Base(cmd)
+	if comm == cmd {
+		return true
 	}
+	return len(comm) == commMaxLen && len(cmd) > commMaxLen && strings.HasPrefix(cmd, comm)
+}
 
-	pid, err := strconv.Atoi(strings.TrimSpace(
-		strings.FieldsFunc(names[procNumber], unicode.IsSpace)[0]),
-	)
+// Pgid returns the process group id of the process.
+func (p *Process) Pgid() (int, error) {
+	pgid, err := syscall.Getpgid(p.Pid)
 	if err != nil {
-		return nil, err
+		return 0, &ProcError{Op: "pgid", Pid: p.Pid, Err: err}
 	}
+	return pgid, nil
+}
 
-	return FindByPid(pid)
+// Sid returns the session id of the process.
+func (p *Process) Sid() (int, error) {
+	sid, err := getsid(p.Pid)
+	if err != nil {
+		return 0, &ProcError{Op: "sid", Pid: p.Pid, Err: err}
+	}
+	return sid, nil
 }
 
-// FindByPid finds and returns a process by it's pid.
-func FindByPid(pid int) (*Process, error) {
-	proc := new(Process)
+// setGroupIDs sets the process's PGID and SID from it's pid, leaving either
+// as 0 if it can't be looked up, such as when the process has just exited.
+func (p *Process) setGroupIDs() {
+	if pgid, err := syscall.Getpgid(p.Pid); err == nil {
+		p.PGID = pgid
+	}
+	if sid, err := getsid(p.Pid); err == nil {
+		p.SID = sid
+	}
+}
 
-	var err error
-	proc.Process, err = os.FindProcess(pid)
+// IsSessionLeader reports whether the process is the leader of it's session,
+// which is when it's pid is it's session id, such as a process started by
+// Start with detach set to true whilst not in a tty.
+func (p *Process) IsSessionLeader() (bool, error) {
+	sid, err := p.Sid()
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	return sid == p.Pid, nil
+}
 
-	pidStr := strconv.Itoa(proc.Pid)
+// SetBackground sets whether the process runs with background priority. On
+// macOS the process is put in the darwin background scheduling class, which
+// also throttles it's disk and network I/O, and on linux it's nice value is
+// set to 19, the lowest priority, or back to the nice value it had before.
+//
+// Lowering a nice value requires root privileges on linux, so
+// SetBackground(false) fails there with a permission error otherwise.
+//
+// SetBackground returns ErrUnsupported on other platforms.
+func (p *Process) SetBackground(bg bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Get the tty= and comm= result from ps. Extract the tty of the process from
-	// the tty= result and use the comm= result to compare to the command= result
-	// below, to extract the process's command args.
-	//
-	// ps -o tty=,comm= -p $PID
-	pidCmd, err := exec.Command("ps", "-o", "tty=,comm=", pidStr).Output()
+	restore := 0
+	if p.nice != nil {
+		restore = *p.nice
+	}
+	prev, err := setBackground(p.Pid, bg, restore)
 	if err != nil {
-		return nil, err
+		return &ProcError{Op: "setbackground", Pid: p.Pid, Err: err}
 	}
 
-	// Split the tty and command parts from the result of the above ps command.
-	psfields := strings.FieldsFunc(string(pidCmd), unicode.IsSpace)
+	// Only keep the nice value from before the first call, so calling
+	// SetBackground(true) twice doesn't lose it.
+	switch {
+	case bg && p.nice == nil:
+		p.nice = &prev
+	case !bg:
+		p.nice = nil
+	}
+	return nil
+}
 
-	// Get the tty of the process.
-	proc.Tty = psfields[0]
+// Detach detaches the process from it's session and controlling terminal.
+//
+// Only a process itself can move to a new session, by calling setsid, so a
+// process that's already running can't be detached by another process. A
+// process that's already the leader of it's own session is left as is,
+// otherwise ErrUnsupported is returned and the process should instead be
+// started detached by passing true for Start's detach argument.
+func (p *Process) Detach() error {
+	leader, err := p.IsSessionLeader()
+	if err != nil {
+		return err
+	}
+	if !leader {
+		return &ProcError{Op: "detach", Pid: p.Pid, Err: fmt.Errorf(
+			"%w: a running process can't be moved to a new session", ErrUnsupported)}
+	}
+	return nil
+}
 
-	// Get the proc's command.
-	proc.Cmd = strings.Join(psfields[1:], " ")
+// Credentials returns the real and effective user and group ids of the
+// process. Comparing the real and effective ids shows whether the process
+// is running setuid or setgid.
+//
+// Credentials is only supported on linux and returns ErrUnsupported
+// elsewhere.
+func (p *Process) Credentials() (ruid, euid, rgid, egid int, err error) {
+	ruid, euid, rgid, egid, err = readCredentials(p.Pid)
+	if err != nil {
+		return 0, 0, 0, 0, &ProcError{Op: "credentials", Pid: p.Pid, Err: err}
+	}
+	return ruid, euid, rgid, egid, nil
+}
 
-	// Extract process's args.
-	//
-	// Get the ps command= string result.
-	pidCommandEq, err := exec.Command("ps", "-o", "command=", pidStr).Output()
+// Cgroups returns the cgroups that the process belongs to, as a map of each
+// cgroup controller to the process's cgroup path for that controller.
+//
+// On systems using cgroup v2, the process's path in the unified hierarchy
+// has an empty controller name.
+//
+// Cgroups is only supported on linux and returns ErrUnsupported elsewhere.
+func (p *Process) Cgroups() (map[string]string, error) {
+	cgroups, err := readCgroups(p.Pid)
 	if err != nil {
-		return nil, err
+		return nil, &ProcError{Op: "cgroups", Pid: p.Pid, Err: err}
+	}
+	return cgroups, nil
+}
+
+// Root returns the process's root directory, as read from the
+// /proc/<pid>/root symlink, which is / unless the process is chrooted, such
+// as when it's inside a container's mount namespace. Like Cgroups, it helps
+// to tell whether a process is containerized.
+//
+// Reading another user's process's root usually requires root privileges,
+// and the permission error is returned if it's not allowed.
+//
+// Root is only supported on linux and returns ErrUnsupported elsewhere.
+func (p *Process) Root() (string, error) {
+	root, err := processRoot(p.Pid)
+	if err != nil {
+		return "", &ProcError{Op: "root", Pid: p.Pid, Err: err}
 	}
+	return root, nil
+}
 
-	// Split the command= string after the comm= string.
-	split := strings.SplitAfter(string(pidCommandEq), proc.Cmd)
+// OOMScoreAdj returns the process's oom score adjustment, which is added to
+// it's oom score by the kernel when choosing a process to kill when the
+// system is out of memory. It ranges from -1000, which stops the process from
+// being chosen at all, to 1000, which makes it the first to be chosen.
+//
+// OOMScoreAdj is only supported on linux and returns ErrUnsupported elsewhere.
+func (p *Process) OOMScoreAdj() (int, error) {
+	adj, err := readOOMScoreAdj(p.Pid)
+	if err != nil {
+		return 0, &ProcError{Op: "oomscoreadj", Pid: p.Pid, Err: err}
+	}
+	return adj, nil
+}
 
-	// Set the process's args.
-	proc.Args = strings.FieldsFunc(split[1], unicode.IsSpace)
+// SetOOMScoreAdj sets the process's oom score adjustment to adj, such as to
+// make a noncritical worker the first process killed when the system is out
+// of memory or to protect a critical one. Lowering another process's
+// adjustment usually requires root privileges, and the permission error is
+// returned if it's not allowed.
+//
+// If adj isn't between -1000 and 1000, ErrInvalidOOMScoreAdj is returned.
+//
+// SetOOMScoreAdj is only supported on linux and returns ErrUnsupported
+// elsewhere.
+func (p *Process) SetOOMScoreAdj(adj int) error {
+	if adj < -1000 || adj > 1000 {
+		return &ProcError{Op: "setoomscoreadj", Pid: p.Pid, Err: ErrInvalidOOMScoreAdj}
+	}
+	if err := writeOOMScoreAdj(p.Pid, adj); err != nil {
+		return &ProcError{Op: "setoomscoreadj", Pid: p.Pid, Err: err}
+	}
+	return nil
+}
 
-	// Find folder of the process (cwd).
-	//
-	// lsof -p $PID
-	lsofOutput, err := exec.Command("lsof", "-p", pidStr).Output()
+// IsStopped reports whether the process is stopped, such as by a SIGSTOP,
+// as opposed to sleeping or running.
+func (p *Process) IsStopped() (bool, error) {
+	state, err := p.State()
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	return state == StateStopped, nil
+}
 
-	scanner := bufio.NewScanner(bytes.NewReader(lsofOutput))
-	for scanner.Scan() {
-		words := strings.FieldsFunc(scanner.Text(), unicode.IsSpace)
-		if words[3] == "cwd" {
-			proc.Cwd = strings.TrimSpace(strings.Join(words[8:], " "))
-		}
+// Reload sends the process a SIGHUP, which many daemons take as a request to
+// reload their configuration.
+func (p *Process) Reload() error {
+	return p.Signal(syscall.SIGHUP)
+}
+
+// ReloadAndWait reloads the process by Reload and then calls probe, as often
+// as DefaultPollConfig describes, until it returns nil, such as to check
+// that the process is serving again with it's new configuration.
+//
+// If probe still fails after timeout, the returned error wraps
+// ErrReloadTimeout along with probe's last error. If the process stops
+// running first, ErrProcNotRunning is returned.
+func (p *Process) ReloadAndWait(probe func() error, timeout time.Duration) error {
+	if err := p.Reload(); err != nil {
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+
+	deadline := time.Now().Add(timeout)
+	next := DefaultPollConfig.backoff()
+	for {
+		err := probe()
+		if err == nil {
+			return nil
+		}
+		if herr := p.HealthCheck(); herr != nil {
+			return herr
+		}
+		if time.Now().After(deadline) {
+			return &ProcError{Op: "reloadandwait", Pid: p.Pid,
+				Err: fmt.Errorf("%w: %v", ErrReloadTimeout, err)}
+		}
+		<-after(next())
+	}
+}
+
+// Suspend stops the process by sending it a SIGSTOP.
+func (p *Process) Suspend() error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+// Resume continues a stopped process by sending it a SIGCONT.
+func (p *Process) Resume() error {
+	return p.Signal(syscall.SIGCONT)
+}
+
+// Start starts a process and notifies on the notify channel
+// when the process has been started. It uses stdin, stdout and
+// stderr for the command's stdin, stdout and stderr respectively.
+//
+// If the notify channel is nil, just return normally so the call doesn't block.
+//
+// The notify channel is only sent to once p.Process is set to the started
+// process, so the process can be used as soon as notify is received.
+//
+// Start is the same as StartWith with only those options set.
+func (p *Process) Start(detach bool, stdin io.Reader, stdout, stderr io.Writer,
+	notify chan<- struct{}) error {
+	return p.StartWith(StartConfig{
+		Detach: detach,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Notify: notify,
+	})
+}
+
+// StartConfig describes how a process is started by StartWith and
+// RestartWith. The zero StartConfig starts a process the same as
+// Start(false, nil, nil, nil, nil).
+type StartConfig struct {
+	// Detach starts the process in a different process group if it's in a
+	// tty, or disconnects it from any tty if it's not, the same as Start's
+	// detach.
+	Detach bool
+
+	// Stdin, Stdout and Stderr are used for the process's stdin, stdout and
+	// stderr. Passing the same writers each time a process is restarted
+	// keeps all of it's output flowing to the same destination.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Env is the environment of the process, in the form "key=value". If
+	// Env is nil, the process's Env is used.
+	Env []string
+
+	// Dir is the working directory of the process. If Dir is empty, the
+	// process runs in the current process's working directory.
+	Dir string
+
+	// Credential is the user and group that the process runs as. If
+	// Credential is nil, the process's Credential is used.
+	Credential *syscall.Credential
+
+	// Notify, if set, is sent to once the process has been started, the
+	// same as Start's notify channel.
+	Notify chan<- struct{}
+}
+
+// RestartWith kills the process if it's running, waits for it to be gone and
+// then starts it again as described by cfg, blocking until the new process
+// exits the same as Start.
+//
+// To keep a process's logs continuous across restarts, pass the same
+// cfg.Stdout and cfg.Stderr that it was first started with.
+func (p *Process) RestartWith(cfg StartConfig) error {
+	if p.Process != nil && p.HealthCheck() == nil {
+		if err := p.KillAndWait(killWaitTimeout); err != nil {
+			return err
+		}
+	}
+	return p.StartWith(cfg)
+}
+
+// StartWith starts a process as described by cfg and notifies on cfg.Notify
+// when the process has been started, the same as Start, and then waits for
+// the process to exit.
+func (p *Process) StartWith(cfg StartConfig) error {
+	// Create a new command to start the process with.
+	c := p.command(cfg.Detach)
+	c.Stdin = cfg.Stdin
+	c.Stdout = cfg.Stdout
+	c.Stderr = cfg.Stderr
+	c.Dir = cfg.Dir
+	if cfg.Env != nil {
+		c.Env = cfg.Env
+	}
+	if cfg.Credential != nil {
+		c.SysProcAttr.Credential = cfg.Credential
+	}
+
+	// Start the command.
+	ch, err := p.startCommand(c)
+	if err != nil {
+		return err
+	}
+
+	// Notify that the process has started if notify isn't nil. This must
+	// happen after startCommand has set p.Process.
+	if cfg.Notify != nil {
+		cfg.Notify <- struct{}{}
+	}
+
+	// Wait for the command to finish.
+	return ch.wait(c)
+}
+
+// StartCombined starts a process the same as Start, but with the process's
+// stdout and stderr both written to combined, such as to log a single
+// interleaved stream of output.
+func (p *Process) StartCombined(detach bool, stdin io.Reader, combined io.Writer,
+	notify chan<- struct{}) error {
+	w := &lockedWriter{w: combined}
+	return p.Start(detach, stdin, w, w, notify)
+}
+
+// lockedWriter serializes writes to w, so that writes made at the same time
+// aren't interleaved with each other.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(b)
+}
+
+// StartPipes starts a process without waiting for it to exit, and returns
+// pipes that are connected to the process's stdin, stdout and stderr.
+//
+// The pipes are held by the Process and are closed by Close.
+func (p *Process) StartPipes(detach bool) (stdin io.WriteCloser, stdout, stderr io.ReadCloser, err error) {
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW)
+		return nil, nil, nil, err
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW, stdoutR, stdoutW)
+		return nil, nil, nil, err
+	}
+
+	c := p.command(detach)
+	c.Stdin = stdinR
+	c.Stdout = stdoutW
+	c.Stderr = stderrW
+
+	ch, err := p.startCommand(c)
+
+	// The process's ends of the pipes aren't needed once it has started.
+	closeFiles(stdinR, stdoutW, stderrW)
+
+	if err != nil {
+		closeFiles(stdinW, stdoutR, stderrR)
+		return nil, nil, nil, err
+	}
+	ch.pipes = []io.Closer{stdinW, stdoutR, stderrR}
+	ch.stdout = stdoutR
+
+	go ch.wait(c)
+
+	return stdinW, stdoutR, stderrR, nil
+}
+
+// StdoutReader returns a reader of the process's stdout, which delivers the
+// process's output as it's written, such as for a live log viewer. It reads
+// from the same pipe as the stdout returned by StartPipes, so only one of
+// them should be read from.
+//
+// If the process wasn't started by StartPipes, ErrProcNoPipes is returned.
+func (p *Process) StdoutReader() (io.Reader, error) {
+	if p.child == nil || p.child.stdout == nil {
+		return nil, ErrProcNoPipes
+	}
+	return p.child.stdout, nil
+}
+
+// command returns a new *exec.Cmd for starting the process.
+func (p *Process) command(detach bool) *exec.Cmd {
+	c := exec.Command(p.Cmd, p.Args...)
+	if p.Umask != nil && c.Err == nil {
+		// The command is looked up before starting sh, so a missing command
+		// still fails to start rather than sh exiting with status 127.
+		//
+		// sh -c 'umask $UMASK && exec "$0" "$@"' $PATH $ARGS
+		c = exec.Command("sh", append([]string{"-c",
+			fmt.Sprintf(`umask %03o && exec "$0" "$@"`, *p.Umask&0777), c.Path}, p.Args...)...)
+	}
+	c.Env = p.Env
+	c.ExtraFiles = p.ExtraFiles
+
+	// Change the process's root directory and credentials if they're set.
+	c.SysProcAttr = &syscall.SysProcAttr{
+		Chroot:     p.Chroot,
+		Credential: p.Credential,
+	}
+
+	if p.InTty() {
+		// Start the process in a different process group if detach is set to true.
+		c.SysProcAttr.Setpgid = detach
+	} else {
+		// If process didn't start in a tty and detach is true, disconnect
+		// process from any tty.
+		c.SysProcAttr.Setsid = detach
+	}
+
+	return c
+}
+
+// startCommand starts c and sets the process to the newly started process,
+// returning the child that tracks it's state.
+func (p *Process) startCommand(c *exec.Cmd) (*child, error) {
+	if err := c.Start(); err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			switch {
+			case p.Chroot != "":
+				return nil, fmt.Errorf("error: chroot to %s requires root privileges: %w",
+					p.Chroot, err)
+			case p.Credential != nil:
+				return nil, fmt.Errorf("error: starting as uid %d requires root privileges: %w",
+					p.Credential.Uid, err)
+			}
+		}
+		return nil, err
+	}
+
+	// Set the process to the newly started process, which hasn't been
+	// closed or reaped yet, even if the process it replaces was.
+	ch := &child{done: make(chan struct{})}
+	p.mu.Lock()
+	p.Process = c.Process
+	p.child = ch
+	p.closed = nil
+	p.reaped = false
+	p.mu.Unlock()
+
+	return ch, nil
+}
+
+// Close closes any pipes held by the process from StartPipes and stops any
+// goroutines that are waiting for the process to exit, such as those
+// started by Done.
+//
+// A process that wasn't started by this package is also released. A process
+// started by this package is released once it has exited.
+//
+// Close only applies to the current process. Starting the process again,
+// such as with Start, RestartWith or Supervise, opens it again, so Done and
+// WaitExitPidfd wait for the new process.
+//
+// Close can safely be called more than once.
+func (p *Process) Close() error {
+	closed := p.closing()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-closed:
+		return nil
+	default:
+	}
+	close(closed)
+
+	if p.child != nil {
+		var err error
+		for _, pipe := range p.child.pipes {
+			if cerr := pipe.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}
+
+	if p.Process != nil {
+		return p.Process.Release()
+	}
+	return nil
+}
+
+// closing returns a channel that's closed when the process is closed.
+func (p *Process) closing() chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed == nil {
+		p.closed = make(chan struct{})
+	}
+	return p.closed
+}
+
+// Done returns a channel that receives the process's final state once the
+// process has exited. The channel is closed after the state has been sent.
+//
+// The state is only available for a process that was started by Start. A
+// process that was found some other way, such as by FindByPid, isn't a child
+// of this process and can't be waited on, so it's instead health checked
+// until it stops running and a nil state is sent.
+//
+// For a process started by Start, call Done after the notify channel has
+// received or Start has returned.
+//
+// If the process is closed by Close before it exits, the channel is closed
+// without a state being sent.
+func (p *Process) Done() <-chan *os.ProcessState {
+	done := make(chan *os.ProcessState, 1)
+	go func() {
+		defer close(done)
+		if p.child != nil {
+			// Don't send a state if the process is already closed, even if
+			// it has also exited.
+			select {
+			case <-p.closing():
+				return
+			default:
+			}
+			select {
+			case <-p.child.done:
+				done <- p.child.state
+			case <-p.closing():
+			}
+			return
+		}
+		if p.waitGone(context.Background()) == nil {
+			done <- nil
+		}
+	}()
+	return done
+}
+
+// Exited reports whether a process started by Start or StartPipes has exited
+// and been waited for, without blocking.
+//
+// Exited always returns false for a process that wasn't started by this
+// package.
+func (p *Process) Exited() bool {
+	if p.child == nil {
+		return false
+	}
+	select {
+	case <-p.child.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitAny blocks until the process has exited or ctx is done, whether or not
+// the process is a child of the current process.
+//
+// An exit status is only available for a child process, such as a process
+// started by Start, in which case WaitAny returns an *exec.ExitError if the
+// process exited unsuccessfully. Any other process can't be waited on, so
+// it's instead health checked until it stops running and nil is returned.
+//
+// If ctx is done whilst waiting for a child that wasn't started by Start,
+// the child is still reaped in the background once it exits.
+func (p *Process) WaitAny(ctx context.Context) error {
+	var state *os.ProcessState
+	switch {
+	case p.child != nil:
+		select {
+		case <-p.child.done:
+			state = p.child.state
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case p.isChild():
+		type waitResult struct {
+			state *os.ProcessState
+			err   error
+		}
+		done := make(chan waitResult, 1)
+		go func() {
+			state, err := p.Process.Wait()
+			done <- waitResult{state, err}
+		}()
+		select {
+		case res := <-done:
+			if res.err != nil {
+				return &ProcError{Op: "waitany", Pid: p.Pid, Err: res.err}
+			}
+			state = res.state
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	default:
+		return p.waitGone(ctx)
+	}
+
+	if !state.Success() {
+		return &exec.ExitError{ProcessState: state}
+	}
+	return nil
+}
+
+// WaitAny blocks until the first of procs has exited, waiting on each of
+// them with it's WaitAny method, and returns that process along with the
+// error from waiting on it, such as an *exec.ExitError.
+//
+// If ctx is done before any of procs exit, WaitAny returns ctx's error. The
+// remaining processes are no longer waited on once WaitAny returns.
+func WaitAny(ctx context.Context, procs ...*Process) (*Process, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type waitResult struct {
+		proc *Process
+		err  error
+	}
+	done := make(chan waitResult, len(procs))
+	for _, proc := range procs {
+		go func(proc *Process) {
+			done <- waitResult{proc, proc.WaitAny(ctx)}
+		}(proc)
+	}
+
+	select {
+	case res := <-done:
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return res.proc, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Reap waits for the process to exit and returns it's state, reaping it if
+// it's a child of the current process, without waiting on any other child.
+//
+// A process can only be reaped once, so calling Reap again returns
+// ErrProcReaped rather than blocking. A process that isn't a child of the
+// current process can't be reaped and ErrProcNotChild is returned.
+//
+// A process started by Start or StartPipes is already reaped in the
+// background once it exits, so Reap only waits for that to happen.
+func (p *Process) Reap() (*os.ProcessState, error) {
+	p.mu.Lock()
+	reaped := p.reaped
+	p.reaped = true
+	p.mu.Unlock()
+	if reaped {
+		return nil, &ProcError{Op: "reap", Pid: p.Pid, Err: ErrProcReaped}
+	}
+
+	if p.child == nil && !p.isChild() {
+		// The process was never reaped, so allow Reap to be called again.
+		p.mu.Lock()
+		p.reaped = false
+		p.mu.Unlock()
+		return nil, &ProcError{Op: "reap", Pid: p.Pid, Err: ErrProcNotChild}
+	}
+
+	if p.child != nil {
+		<-p.child.done
+		return p.child.state, nil
+	}
+
+	state, err := p.Process.Wait()
+	if err != nil {
+		return nil, &ProcError{Op: "reap", Pid: p.Pid, Err: err}
+	}
+	return state, nil
+}
+
+// WaitExitPidfd blocks until the process has exited or ctx is done, such as
+// for a process that isn't a child of the current process and so can't be
+// waited on. Unlike polling, a process that only runs briefly can't be
+// missed, and the exit is seen as soon as it happens.
+//
+// On linux 5.3 and later, WaitExitPidfd waits on a pidfd for the process,
+// which becomes readable once it exits, even if it's left a zombie. On older
+// kernels and elsewhere, the process is health checked as often as
+// DefaultPollConfig describes until it's no longer running.
+//
+// If the process is closed by Close whilst waiting, ErrProcClosed is
+// returned.
+func (p *Process) WaitExitPidfd(ctx context.Context) error {
+	err := waitPidfd(ctx, p.Pid, p.closing())
+	if err == ErrUnsupported {
+		return p.waitGone(ctx)
+	}
+	if err != nil && err != ctx.Err() && err != ErrProcClosed {
+		return &ProcError{Op: "waitexitpidfd", Pid: p.Pid, Err: err}
+	}
+	return err
+}
+
+// waitGone blocks until the process is no longer running, health checking
+// it as often as DefaultPollConfig describes, or until ctx is done or the
+// process is closed.
+//
+// On linux HealthCheck reports a zombie process as not running, so a process
+// that isn't reaped, such as an orphan whose new parent never waits, is
+// still seen as gone there.
+func (p *Process) waitGone(ctx context.Context) error {
+	next := DefaultPollConfig.backoff()
+	for {
+		if p.HealthCheck() != nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.closing():
+			return ErrProcClosed
+		case <-after(next()):
+		}
+	}
+}
+
+// isChild reports whether the process is a child of the current process.
+func (p *Process) isChild() bool {
+	ppid, err := psField(p.Pid, "ppid")
+	return err == nil && ppid == strconv.Itoa(os.Getpid())
+}
+
+// RunWithInput runs the process's command and args in the process's cwd and
+// environment, writing input to it's stdin, and returns everything that was
+// written to it's stdout and stderr once it has exited.
+//
+// If the command exits unsuccessfully, the returned error is an
+// *exec.ExitError and stdout and stderr still contain the captured output.
+func (p *Process) RunWithInput(input string) (stdout string, stderr string, err error) {
+	c := exec.Command(p.Cmd, p.Args...)
+	c.Dir = p.Cwd
+	c.Env = p.Env
+	c.Stdin = strings.NewReader(input)
+
+	var outBuf, errBuf bytes.Buffer
+	c.Stdout = &outBuf
+	c.Stderr = &errBuf
+
+	err = c.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+// StartTty requires sudo to work.
+//
+// StartTty starts a process in a tty and notifies on the notify channel
+// when the process has been started.
+//
+// If the notify channel is nil, just return normally so the call doesn't block.
+//
+// The notify channel is here for consistency with the notify channel from
+// the Start method.
+//
+// If the started process doesn't show up in ps after StartTtyAttempts tries,
+// StartTty returns ErrRestartTimeout.
+func (p *Process) StartTty(ttyFd uintptr, notify chan<- struct{}) error {
+	// Append a new line character to the full command so the command
+	// actually executes.
+	fullCommandNL := p.FullCommand() + "\n"
+
+	// Write each byte from fullCommandNL to the tty instance.
+	if err := p.InjectTty(ttyFd, []byte(fullCommandNL)); err != nil {
+		return err
+	}
+
+	// Get the new PID of the restarted process, waiting for it to show up
+	// in ps since it might not have started yet.
+	if err := p.FindProcessRetry(StartTtyAttempts, StartTtyInterval); err != nil {
+		if err == ErrProcNotFound {
+			return &ProcError{Op: "starttty", Pid: p.Pid, Err: ErrRestartTimeout}
+		}
+		return err
+	}
+
+	// Notify that the process has started if notify isn't nil.
+	if notify != nil {
+		notify <- struct{}{}
+	}
+
+	return nil
+}
+
+// StartTtySelf starts the process in it's own tty the same as StartTty,
+// opening the tty with OpenTtyFile and closing it once done, so the caller
+// doesn't need to open the tty themselves.
+//
+// If the process doesn't have a tty, ErrProcNotInTty is returned.
+func (p *Process) StartTtySelf(notify chan<- struct{}) error {
+	tty, err := p.OpenTtyFile()
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	return p.StartTty(tty.Fd(), notify)
+}
+
+// InjectTty requires sudo to work.
+//
+// InjectTty writes data to the input of the tty that ttyFd refers to, one
+// byte at a time, as if the data had been typed into the tty. The data can
+// contain control bytes, such as 0x03 for a Ctrl-C.
+//
+// If data is empty, InjectTty does nothing.
+func (p *Process) InjectTty(ttyFd uintptr, data []byte) error {
+	// The tty can be written to before the process is started, so there
+	// mightn't be a pid to report yet.
+	pid := 0
+	if p.Process != nil {
+		pid = p.Pid
+	}
+	for i := range data {
+		_, _, eno := syscall.Syscall(syscall.SYS_IOCTL,
+			ttyFd,
+			syscall.TIOCSTI,
+			uintptr(unsafe.Pointer(&data[i])),
+		)
+		if eno != 0 {
+			return &ProcError{Op: "injecttty", Pid: pid, Err: eno}
+		}
+	}
+	return nil
+}
+
+// FindProcess finds and then sets a Process's process based
+// on it's command, it's command's arguments and it's tty.
+func (p *Process) FindProcess() error {
+	if p.Process == nil {
+		p.Process = &os.Process{}
+	}
+
+	procs, err := p.FindAll()
+	if err != nil {
+		return err
+	}
+	if len(procs) == 0 {
+		return ErrProcNotFound
+	}
+	p.Pid = procs[len(procs)-1].Pid
+
+	// Reset p.Process to the new process found from the new pid.
+	p.Process, err = os.FindProcess(p.Pid)
+	return err
+}
+
+// FindAll returns every process whose ps line contains both the process's cmd
+// and tty, without changing the process itself. Each process returned has the
+// same cmd as the process and the tty that it was found with.
+func (p *Process) FindAll() ([]*Process, error) {
+	if p.Cmd == "" {
+		return nil, ErrProcCommandEmpty
+	}
+
+	ps, err := runOutput("ps", "-e")
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []*Process
+	err = scanPsLines(bytes.NewReader(ps), func(line string) error {
+		if !strings.Contains(line, p.Cmd) || !strings.Contains(line, p.Tty) {
+			return nil
+		}
+		// ps -e lines are in the form PID TTY TIME CMD.
+		fields, _ := splitWords(line, 2)
+		if len(fields) < 2 {
+			return nil
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		proc, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		procs = append(procs, &Process{Process: proc, Tty: fields[1], Cmd: p.Cmd})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return procs, nil
+}
+
+// FindProcessRetry calls FindProcess up to attempts times, sleeping for delay
+// between each attempt, until the process is found. If every attempt fails,
+// the error from the last attempt is returned.
+//
+// FindProcessRetry is useful straight after a process has been started, when
+// the process might not yet show up in ps. Unlike the functions that use
+// DefaultPollConfig, delay doesn't back off.
+func (p *Process) FindProcessRetry(attempts int, delay time.Duration) error {
+	err := p.FindProcess()
+	for i := 1; i < attempts && err != nil; i++ {
+		<-after(delay)
+		err = p.FindProcess()
+	}
+	return err
+}
+
+// FullCommand returns a string containing the process's
+// cmd and any args that it has joined to it by a space.
+//
+// If there are no args, FullCommand returns just the cmd.
+func (p *Process) FullCommand() string {
+	if len(p.Args) == 0 {
+		return p.Cmd
+	}
+	return fmt.Sprintf("%s %s", p.Cmd, strings.Join(p.Args, " "))
+}
+
+// ScriptPath returns the script that the process's interpreter is running,
+// such as /path/app.py for python3 /path/app.py --flag, so that the actual
+// program can be told apart from other processes running the same
+// interpreter.
+//
+// The script is the first of the process's args, read fresh from the pid,
+// that isn't a flag. If the interpreter is given code with a flag such as -c,
+// -e or -m, or there's no arg that isn't a flag, ErrNoScript is returned.
+func (p *Process) ScriptPath() (string, error) {
+	comm, err := psField(p.Pid, "comm")
+	if err != nil {
+		return "", &ProcError{Op: "scriptpath", Pid: p.Pid, Err: err}
+	}
+	args, err := readArgs(p.Pid, comm)
+	if err != nil {
+		return "", &ProcError{Op: "scriptpath", Pid: p.Pid, Err: err}
+	}
+
+	for i, arg := range args {
+		switch {
+		case arg == "-c" || arg == "-e" || arg == "-m" || arg == "-":
+			return "", &ProcError{Op: "scriptpath", Pid: p.Pid, Err: ErrNoScript}
+		case arg == "--":
+			if i+1 < len(args) {
+				return args[i+1], nil
+			}
+		case !strings.HasPrefix(arg, "-"):
+			return arg, nil
+		}
+	}
+	return "", &ProcError{Op: "scriptpath", Pid: p.Pid, Err: ErrNoScript}
+}
+
+// QuotedCommand returns the process's cmd and args joined by a space like
+// FullCommand, but with any of them that contain white space, quotes or
+// other characters special to a shell wrapped in single quotes, so that the
+// command can be pasted into a shell as is.
+func (p *Process) QuotedCommand() string {
+	quoted := make([]string, 0, len(p.Args)+1)
+	for _, arg := range p.Reconstruct() {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote returns s single quoted for a shell, unless it only contains
+// characters that are safe to leave unquoted. Each single quote within s
+// ends the quoting, is escaped with a backslash and then starts it again.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyz"+
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Reconstruct returns the process's argv, it's command followed by it's
+// args, which can be passed straight to exec.Command to run the process
+// again without losing any args containing white space, unlike splitting
+// FullCommand.
+//
+// The Cmd of a found process is only it's comm, which is a base name that
+// linux truncates to 15 bytes, so the command is read from the running
+// process where possible, such as from /proc/<pid>/cmdline on linux. If the
+// process can't be read or no longer matches Cmd, Cmd is used instead.
+func (p *Process) Reconstruct() []string {
+	argv0 := p.Cmd
+	if p.Process != nil {
+		if cmd, err := processArgv0(p.Pid, p.Cmd); err == nil && cmd != "" && commMatches(p.Cmd, cmd) {
+			argv0 = cmd
+		}
+	}
+	return append([]string{argv0}, p.Args...)
+}
+
+// Identity returns an id for the process made from a hash of it's command,
+// args and start time.
+//
+// Unlike it's pid, which can be reused by the system once the process exits,
+// the identity is the same every time the same process is found and differs
+// between processes, so it can be used to tell processes apart across
+// separate scans of the process table.
+func (p *Process) Identity() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00", p.Cmd, p.StartTime.UnixNano())
+	for _, arg := range p.Args {
+		io.WriteString(h, arg)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// InTty returns a true or false depending if p.Tty is ?? or ?, which is how
+// ps reports no tty on macOS and linux, or a value such as ttys001.
+func (p *Process) InTty() bool {
+	return p.Tty != "??" && p.Tty != "?"
+}
+
+// TtyDevice returns the path of the device file of the process's tty, such
+// as /dev/pts/3 or /dev/ttys001.
+func (p *Process) TtyDevice() (string, error) {
+	if !p.InTty() {
+		return "", ErrProcNotInTty
+	}
+	return ttyPath(p.Tty), nil
+}
+
+// ttyPath returns the path of the device file of a tty named as by ps, which
+// is relative to /dev, such as pts/3 on linux or ttys001 on macOS, except
+// that macOS's ps abbreviates ttys001 to s001 in some output formats.
+func ttyPath(tty string) string {
+	if strings.HasPrefix(tty, "/dev/") {
+		return tty
+	}
+	if len(tty) > 1 && tty[0] == 's' && strings.Trim(tty[1:], "0123456789") == "" {
+		return "/dev/tty" + tty
+	}
+	return "/dev/" + tty
+}
+
+// OpenTty returns an opened file handle to the tty of the process.
+func (p *Process) OpenTty() (*os.File, error) {
+	if !p.InTty() {
+		return nil, ErrProcNotInTty
+	}
+	return os.Open(ttyPath(p.Tty))
+}
+
+// ExePath returns the absolute path of the executable that the process is
+// running, which unlike it's cmd isn't just the executable's name.
+//
+// Any error returned is a *ProcError, such as when the caller doesn't have
+// permission to inspect the process.
+func (p *Process) ExePath() (string, error) {
+	path, err := processExe(p.Pid)
+	if err != nil {
+		return "", &ProcError{Op: "exepath", Pid: p.Pid, Err: err}
+	}
+	return path, nil
+}
+
+// StdStreams returns where the process's stdin, stdout and stderr point to,
+// such as to find out where a process's output is going. Each is the path of
+// a file or device, such as /dev/null or /dev/pts/0, or a label for anything
+// else, such as pipe:[12345] or socket:[12345], and is empty if it's closed.
+//
+// On linux the streams are read from the /proc/<pid>/fd symlinks, and
+// elsewhere they're found using lsof.
+func (p *Process) StdStreams() (stdin, stdout, stderr string, err error) {
+	streams, err := processStdStreams(p.Pid)
+	if err != nil {
+		return "", "", "", &ProcError{Op: "stdstreams", Pid: p.Pid, Err: err}
+	}
+	return streams[0], streams[1], streams[2], nil
+}
+
+// NumFDs returns the number of file descriptors that the process has open,
+// such as to watch for a descriptor leak, without listing each of them.
+//
+// On linux the entries of /proc/<pid>/fd are counted, and elsewhere the
+// descriptors listed by lsof are counted.
+func (p *Process) NumFDs() (int, error) {
+	n, err := processNumFDs(p.Pid)
+	if err != nil {
+		return 0, &ProcError{Op: "numfds", Pid: p.Pid, Err: err}
+	}
+	return n, nil
+}
+
+// ExeChecksum returns the hex encoded SHA-256 checksum of the executable at
+// the process's ExePath, such as to check that a long running process's
+// binary hasn't been replaced on disk since it was started.
+//
+// If the executable can't be read, such as when it has been removed or the
+// caller doesn't have permission to read it, the *ProcError returned wraps
+// the error from opening or reading it.
+func (p *Process) ExeChecksum() (string, error) {
+	path, err := p.ExePath()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", &ProcError{Op: "exechecksum", Pid: p.Pid, Err: err}
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", &ProcError{Op: "exechecksum", Pid: p.Pid, Err: err}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CwdExists reports whether the process's cwd exists as a directory from
+// the point of view of the calling process.
+//
+// The cwd of a process running in another mount namespace, such as inside
+// a container, is the path within that namespace, so it can't always be
+// resolved from the host.
+func (p *Process) CwdExists() bool {
+	if p.Cwd == "" {
+		return false
+	}
+	info, err := os.Stat(p.Cwd)
+	return err == nil && info.IsDir()
+}
+
+// OpenTtyFile returns a file handle to the tty of the process opened for
+// reading and writing, such as for passing it's fd to StartTty. The tty is
+// opened without it becoming the controlling tty of the current process.
+func (p *Process) OpenTtyFile() (*os.File, error) {
+	if !p.InTty() {
+		return nil, ErrProcNotInTty
+	}
+	return os.OpenFile(ttyPath(p.Tty), os.O_RDWR|syscall.O_NOCTTY, 0)
+}
+
+// TtySize returns the window size of the process's tty in rows and columns,
+// read with the TIOCGWINSZ ioctl. If the process doesn't have a tty,
+// ErrProcNotInTty is returned.
+func (p *Process) TtySize() (rows, cols int, err error) {
+	tty, err := p.OpenTtyFile()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tty.Close()
+
+	// winsize is the struct winsize filled in by TIOCGWINSZ.
+	var winsize struct {
+		Row, Col       uint16
+		Xpixel, Ypixel uint16
+	}
+	_, _, eno := syscall.Syscall(syscall.SYS_IOCTL,
+		tty.Fd(),
+		syscall.TIOCGWINSZ,
+		uintptr(unsafe.Pointer(&winsize)),
+	)
+	if eno != 0 {
+		return 0, 0, &ProcError{Op: "ttysize", Pid: p.Pid, Err: eno}
+	}
+	return int(winsize.Row), int(winsize.Col), nil
+}
+
+// IsForeground reports whether the process is in the foreground process group
+// of it's controlling tty, which is the group that receives input and
+// signals such as Ctrl-C from the tty.
+//
+// If the process doesn't have a controlling tty, ErrProcNotInTty is returned.
+func (p *Process) IsForeground() (bool, error) {
+	pgid, tpgid, err := ttyProcessGroups(p.Pid)
+	if err != nil {
+		return false, &ProcError{Op: "isforeground", Pid: p.Pid, Err: err}
+	}
+	if tpgid <= 0 {
+		return false, ErrProcNotInTty
+	}
+	return pgid == tpgid, nil
+}
+
+// Chdir changes the current working directory to the processes cwd.
+func (p *Process) Chdir() error {
+	return os.Chdir(p.Cwd)
+}
+
+// Find by name takes in a name and through a process of elimination by
+// prompting the user to select the correct process from a list, finds
+// and returns a process by it's name.
+//
+// FindByName writes the pid and cmd of each of the Candidates for name to
+// the specified stdout and then scans the number for choosing the correct
+// process from the specified stdin.
+func FindByName(stdout io.Writer, stdin io.Reader, name string) (*Process, error) {
+	candidates, err := Candidates(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Display a list of all the found processes.
+	for i, proc := range candidates {
+		fmt.Fprintf(stdout, "%d: %d %s\n", i, proc.Pid, proc.Cmd)
+	}
+
+	procNumber := -1
+	fmt.Fprintln(stdout, "\nWhich number above represents the correct process (enter the number):")
+	fmt.Fscanf(stdin, "%d", &procNumber)
+
+	return selectCandidate(candidates, procNumber)
+}
+
+// SelectByName finds the processes whose ps line contains name the same as
+// FindByName, but instead of prompting for which process is correct, it
+// selects the process at index in the list that FindByName would display.
+//
+// If index is out of range, ErrInvalidNumber is returned.
+func SelectByName(name string, index int) (*Process, error) {
+	candidates, err := Candidates(name)
+	if err != nil {
+		return nil, err
+	}
+	return selectCandidate(candidates, index)
+}
+
+// Candidates returns the processes that FindByName lists for name, which
+// are those whose lowercased ps line contains name, in the same order.
+//
+// Each Process only has it's Pid, Tty and Cmd set.
+func Candidates(name string) ([]*Process, error) {
+	psOutput, err := runOutput("ps", "-e")
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*Process
+	err = scanPsLines(bytes.NewReader(psOutput), func(line string) error {
+		if !strings.Contains(strings.ToLower(line), name) {
+			return nil
+		}
+		// ps -e lines are in the form PID TTY TIME CMD.
+		fields, cmd := splitWords(line, 3)
+		if len(fields) < 3 {
+			return nil
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		proc, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, &Process{Process: proc, Tty: fields[1], Cmd: cmd})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// selectCandidate finds the process at index in candidates by it's pid.
+func selectCandidate(candidates []*Process, index int) (*Process, error) {
+	if index < 0 || index >= len(candidates) {
+		return nil, ErrInvalidNumber
+	}
+	return FindByPid(candidates[index].Pid)
+}
+
+// ForEach streams the process table from ps, calling fn with a Process for
+// each process in the table, line by line.
+//
+// Each Process only has it's Pid, PPid, UID, Tty and Cmd set. If fn returns a
+// non-nil error, ForEach stops iterating and returns that error.
+//
+// ForEach is more memory efficient than ListAll for large process tables
+// or when only the first few matching processes are needed.
+func ForEach(fn func(*Process) error) error {
+	return forEach(context.Background(), "pid=,ppid=,uid=,tty=,comm=", parsePsLine, fn)
+}
+
+// forEach streams the process table from ps with the specified output
+// format, calling fn with the Process that parse returns for each line,
+// until fn returns an error or ctx is done.
+func forEach(ctx context.Context, format string, parse func(line string) (*Process, error),
+	fn func(*Process) error) (err error) {
+	// ps -e -o $FORMAT
+	c := toolCommand("ps", "-e", "-o", format)
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	start, n := time.Now(), 0
+	defer func() {
+		logf("exec ps -e -o %s: %d processes in %s, error: %v",
+			format, n, time.Since(start), err)
+	}()
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	// Stop ps if ctx is done before it finishes.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Process.Kill()
+		case <-stop:
+		}
+	}()
+
+	err = scanPsLines(stdout, func(line string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		proc, err := parse(line)
+		if err != nil {
+			logf("parse ps line %q: error: %v", line, err)
+			return err
+		}
+		n++
+		return fn(proc)
+	})
+	if err != nil {
+		// Stop ps early since the rest of it's output isn't needed.
+		c.Process.Kill()
+		c.Wait()
+		return err
+	}
+
+	err = c.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Each streams the process table the same as ForEach, calling fn with a
+// Process for each process in the table, except that if fn returns
+// ErrStopIteration, or an error wrapping it, Each stops iterating and
+// returns nil.
+func Each(fn func(*Process) error) error {
+	if err := ForEach(fn); !errors.Is(err, ErrStopIteration) {
+		return err
+	}
+	return nil
+}
+
+// ListAll returns a Process for every process in the process table.
+//
+// Each Process only has it's Pid, PPid, UID, Tty and Cmd set.
+func ListAll() ([]*Process, error) {
+	return ListAllContext(context.Background())
+}
+
+// ListAllContext is like ListAll but stops listing the process table once
+// ctx is done, in which case ctx's error is returned.
+func ListAllContext(ctx context.Context) ([]*Process, error) {
+	return listAll(ctx, "pid=,ppid=,uid=,tty=,comm=", parsePsLine)
+}
+
+// Snapshot returns a Process for every process in the process table along
+// with it's resource usage, all from a single call to ps, such as to show
+// the busiest processes. If ctx is done before the process table has been
+// read, ctx's error is returned.
+//
+// Each Process only has it's Pid, PPid, UID, Tty, Cmd, RSS, CPUPercent and
+// RunState set.
+func Snapshot(ctx context.Context) ([]*Process, error) {
+	return listAll(ctx, snapshotFormat, parseSnapshotLine)
+}
+
+// Stream sends a fresh listing of the process table from ListAllContext on
+// the returned channel straight away and then every interval, such as for a
+// live top like display, until ctx is done, when the channel is closed.
+//
+// A listing that fails is skipped, and a listing isn't taken again until the
+// previous one has been received.
+func Stream(ctx context.Context, interval time.Duration) <-chan []*Process {
+	listings := make(chan []*Process)
+	go func() {
+		defer close(listings)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			procs, err := ListAllContext(ctx)
+			if err != nil {
+				logf("stream: error: %v", err)
+			} else {
+				select {
+				case listings <- procs:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return listings
+}
+
+// snapshotFormat is the ps output format parsed by parseSnapshotLine.
+const snapshotFormat = "pid=,ppid=,uid=,tty=,rss=,%cpu=,state=,comm="
+
+// listAll returns every Process that forEach finds.
+func listAll(ctx context.Context, format string, parse func(line string) (*Process, error)) ([]*Process, error) {
+	var procs []*Process
+	err := forEach(ctx, format, parse, func(proc *Process) error {
+		procs = append(procs, proc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return procs, nil
+}
+
+// Zombies returns a Process for every zombie process, which has exited but
+// hasn't yet been reaped by it's parent. Each Process's PPid is the parent
+// that's failing to reap it.
+//
+// Each Process is found the same as by Snapshot, from a single call to ps.
+func Zombies() ([]*Process, error) {
+	procs, err := listAll(context.Background(), snapshotFormat, parseSnapshotLine)
+	if err != nil {
+		return nil, err
+	}
+
+	var zombies []*Process
+	for _, proc := range procs {
+		if proc.RunState == StateZombie {
+			zombies = append(zombies, proc)
+		}
+	}
+	return zombies, nil
+}
+
+// FindOpts describes which processes are matched when searching the
+// process table with Find.
+type FindOpts struct {
+	// Name matches processes whose command contains Name, ignoring case.
+	// An empty Name matches every process.
+	Name string
+
+	// OwnedByMe restricts matches to processes whose UID is the
+	// current user's uid.
+	OwnedByMe bool
+}
+
+// Match reports whether proc matches the options.
+func (opts FindOpts) Match(proc *Process) bool {
+	if opts.OwnedByMe && proc.UID != os.Getuid() {
+		return false
+	}
+	return strings.Contains(strings.ToLower(proc.Cmd), strings.ToLower(opts.Name))
+}
+
+// Find returns every process in the process table that matches opts.
+//
+// Each Process only has it's Pid, PPid, UID, Tty and Cmd set.
+func Find(opts FindOpts) ([]*Process, error) {
+	var procs []*Process
+	err := ForEach(func(proc *Process) error {
+		if opts.Match(proc) {
+			procs = append(procs, proc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return procs, nil
+}
+
+// FindAllByName returns every process whose command contains name, ignoring
+// case.
+//
+// Each Process only has it's Pid, PPid, UID, Tty and Cmd set.
+func FindAllByName(name string) ([]*Process, error) {
+	return Find(FindOpts{Name: name})
+}
+
+// KillByName finds every process whose command contains name and sends sig
+// to each process that confirm returns true for, like pkill, returning the
+// pids of the processes that were signalled.
+//
+// If confirm is nil, every matching process is signalled. KillByName is the
+// same as KillByNameOpts with only Confirm set, so the current process is
+// never signalled.
+func KillByName(name string, sig syscall.Signal, confirm func(*Process) bool) (killed []int, err error) {
+	return KillByNameOpts(name, sig, KillOpts{Confirm: confirm})
+}
+
+// KillOpts describes which of the processes found by KillByNameOpts are
+// signalled.
+type KillOpts struct {
+	// Confirm, if set, is called with each matching process and the process
+	// is only signalled if Confirm returns true.
+	Confirm func(*Process) bool
+
+	// IncludeSelf allows the current process to be signalled if it matches.
+	// Even then, it's only signalled if ProtectCriticalPids isn't set.
+	IncludeSelf bool
+}
+
+// KillByNameOpts finds every process whose command contains name, found by
+// FindAllByName, and sends sig to each of them that opts allows, returning
+// the pids of the processes that were signalled.
+//
+// Every process is signalled even if signalling one of them fails, and the
+// returned error joins the *ProcError of each process that couldn't be
+// signalled.
+func KillByNameOpts(name string, sig syscall.Signal, opts KillOpts) (killed []int, err error) {
+	procs, err := FindAllByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, proc := range procs {
+		if proc.Pid == os.Getpid() && !opts.IncludeSelf {
+			continue
+		}
+		if opts.Confirm != nil && !opts.Confirm(proc) {
+			continue
+		}
+		if err := proc.Signal(sig); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		killed = append(killed, proc.Pid)
+	}
+
+	return killed, errors.Join(errs...)
+}
+
+// FindByOpenFile returns a Process for every process that has the file at
+// path open, which is useful to find out what's using a file before it's
+// removed, rotated or unmounted.
+//
+// Processes whose open files can't be read, such as those owned by another
+// user when not running as root, are skipped rather than causing an error,
+// so the result might only be partial. Each Process is found the same as
+// by FindByPidFast.
+func FindByOpenFile(path string) ([]*Process, error) {
+	pids, err := openFilePids(path)
+	if err != nil {
+		return nil, err
+	}
+	return findByPids(pids), nil
+}
+
+// FindByPort returns a Process for every process with a socket listening on
+// the port, where proto is either tcp or udp, such as to find out what's
+// using a port. If nothing is listening on the port, no processes are
+// returned.
+//
+// Like FindByOpenFile, processes that can't be inspected are skipped.
+func FindByPort(proto string, port int) ([]*Process, error) {
+	if proto != "tcp" && proto != "udp" {
+		return nil, fmt.Errorf("error: unknown protocol %q", proto)
+	}
+
+	pids, err := portPids(proto, port)
+	if err != nil {
+		return nil, err
+	}
+	return findByPids(pids), nil
+}
+
+// findByPids returns a Process for each of pids found by findByPidFast,
+// skipping any that can't be found.
+func findByPids(pids []int) []*Process {
+	var procs []*Process
+	for _, pid := range pids {
+		proc, err := findByPidFast(pid)
+		if err != nil {
+			// The process might have exited since it was found.
+			continue
+		}
+		procs = append(procs, proc)
+	}
+	return procs
+}
+
+// scanPsLines calls fn with each process's line of the ps output read from r,
+// skipping any header lines, until fn returns an error.
+//
+// The lines before the first line that starts with a pid are headers, and a
+// later line that's the same as one of them is a repeated header and is also
+// skipped. A process's command can contain newlines, so any other line that
+// doesn't start with a pid is treated as a continuation of the previous
+// process's line and is joined to it. A continuation line that happens to
+// start with a number can't be told apart from a new process's line.
+func scanPsLines(r io.Reader, fn func(line string) error) error {
+	var line string
+	headers := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if _, ok := psPid(text); !ok {
+			switch {
+			case line == "":
+				headers[strings.TrimSpace(text)] = true
+			case !headers[strings.TrimSpace(text)]:
+				line += "\n" + text
+			}
+			continue
+		}
+		if line != "" {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		line = text
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if line != "" {
+		return fn(line)
+	}
+	return nil
+}
+
+// psPid returns the pid at the start of a line of ps output. ok is false if
+// the line doesn't start with a pid, such as ps's header line.
+func psPid(line string) (pid int, ok bool) {
+	fields := strings.FieldsFunc(line, unicode.IsSpace)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	return pid, err == nil
+}
+
+// parsePsLine parses a line of ps -o pid=,ppid=,uid=,tty=,comm= output into
+// a Process.
+//
+// The command is the rest of the line, which is kept as is, since it may
+// contain white space such as newlines.
+func parsePsLine(line string) (*Process, error) {
+	fields, comm := splitWords(line, 4)
+	if len(fields) < 4 || comm == "" {
+		return nil, fmt.Errorf("error: invalid ps line: %q", line)
+	}
+	return psProcess(fields, comm)
+}
+
+// parseSnapshotLine parses a line of
+// ps -o pid=,ppid=,uid=,tty=,rss=,%cpu=,state=,comm= output into a Process.
+func parseSnapshotLine(line string) (*Process, error) {
+	fields, comm := splitWords(line, 7)
+	if len(fields) < 7 || comm == "" {
+		return nil, fmt.Errorf("error: invalid ps line: %q", line)
+	}
+
+	proc, err := psProcess(fields[:4], comm)
+	if err != nil {
+		return nil, err
+	}
+
+	// rss is reported in kilobytes.
+	rss, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	proc.RSS = rss * 1024
+
+	proc.CPUPercent, err = strconv.ParseFloat(fields[5], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	proc.RunState = State(fields[6][0])
+	proc.setGroupIDs()
+
+	return proc, nil
+}
+
+// psProcess returns a Process from the pid, ppid, uid and tty fields and the
+// comm of a line of ps output.
+func psProcess(fields []string, comm string) (*Process, error) {
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Process{
+		Process: proc,
+		PPid:    ppid,
+		UID:     uid,
+		Tty:     fields[3],
+		Cmd:     comm,
+	}, nil
+}
+
+// splitWords splits the first n words from s, returning them along with the
+// rest of s after the n words with any surrounding white space trimmed.
+func splitWords(s string, n int) (words []string, rest string) {
+	rest = s
+	for len(words) < n {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+		i := strings.IndexFunc(rest, unicode.IsSpace)
+		if i < 0 {
+			i = len(rest)
+		}
+		words = append(words, rest[:i])
+		rest = rest[i:]
+	}
+	return words, strings.TrimSpace(rest)
+}
+
+// Exists reports whether a process with the specified pid exists, without
+// building a full Process.
+//
+// A process that exists but that can't be signalled by the caller, such as
+// a process owned by another user, is reported as existing.
+func Exists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// FromCmd returns a Process for the process of c, which must already have
+// been started. The Process's cmd, args, cwd and environment are those that
+// c was started with, and it's tty is found from ps if possible.
+func FromCmd(c *exec.Cmd) (*Process, error) {
+	if c.Process == nil {
+		return nil, ErrCmdNotStarted
+	}
+
+	proc := &Process{
+		Process: c.Process,
+		Cmd:     c.Path,
+		Cwd:     c.Dir,
+		Env:     c.Env,
+	}
+	if len(c.Args) > 0 {
+		proc.Cmd = c.Args[0]
+		proc.Args = c.Args[1:]
+	}
+
+	// A cmd without a dir is run in the current process's cwd.
+	if proc.Cwd == "" {
+		proc.Cwd, _ = os.Getwd()
+	}
+
+	proc.Tty, _ = psField(proc.Pid, "tty")
+
+	return proc, nil
+}
+
+// FindByPidString finds and returns a process by it's pid the same as
+// FindByPid, but with the pid given as a string, such as a command line
+// argument. If s isn't a positive number, ErrInvalidNumber is returned.
+func FindByPidString(s string) (*Process, error) {
+	pid, err := parsePid(s)
+	if err != nil {
+		return nil, err
+	}
+	return FindByPid(pid)
+}
+
+// parsePid parses s as a pid, ignoring any surrounding white space. If s
+// isn't a positive number, ErrInvalidNumber is returned.
+func parsePid(s string) (int, error) {
+	pid, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || pid <= 0 {
+		return 0, ErrInvalidNumber
+	}
+	return pid, nil
+}
+
+// Self returns a Process for the current program, found the same as by
+// FindByPid.
+func Self() (*Process, error) {
+	return FindByPid(os.Getpid())
+}
+
+// FindByPid finds and returns a process by it's pid.
+//
+// Any error returned is a *ProcError.
+func FindByPid(pid int) (*Process, error) {
+	proc, err := findByPid(pid)
+	if err != nil {
+		return nil, &ProcError{Op: "findbypid", Pid: pid, Err: err}
+	}
+	return proc, nil
+}
+
+// FindByPidFast finds and returns a process by it's pid, like FindByPid,
+// except that the process's Cwd is left empty.
+//
+// Outside of linux, finding the cwd of a process requires lsof, which can
+// take hundreds of milliseconds to run, so FindByPidFast should be preferred
+// when the cwd isn't needed. On linux the cwd is cheaply read from /proc, so
+// there's little difference between the two.
+//
+// Any error returned is a *ProcError.
+func FindByPidFast(pid int) (*Process, error) {
+	proc, err := findByPidFast(pid)
+	if err != nil {
+		return nil, &ProcError{Op: "findbypidfast", Pid: pid, Err: err}
+	}
+	return proc, nil
+}
+
+func findByPid(pid int) (*Process, error) {
+	proc, err := findByPidFast(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find folder of the process (cwd).
+	proc.Cwd, err = processCwd(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return proc, nil
+}
+
+func findByPidFast(pid int) (*Process, error) {
+	proc, err := findByPidFields(pid, "uid", "tty", "comm", "command", "lstart")
+	if err != nil {
+		return nil, err
+	}
+	proc.setGroupIDs()
+	return proc, nil
+}
+
+// psFields lists the fields that FindByPidFields can find, in the order that
+// they're requested from ps. lstart is always five words long and comm can
+// contain white space, so they come after every field that's a single word.
+var psFields = []string{"uid", "ppid", "rss", "%cpu", "state", "tty", "lstart", "comm", "command"}
+
+// FindByPidFields finds and returns a process by it's pid, populating only
+// the requested fields, which are named after their ps field names:
+//
+//	tty      Tty
+//	comm     Cmd
+//	command  Cmd and Args
+//	uid      UID
+//	ppid     PPid
+//	state    RunState
+//	rss      RSS
+//	%cpu     CPUPercent
+//	lstart   StartTime
+//
+// All of the requested fields are found with a single call to ps, except for
+// the args, which are read from /proc on linux and need a second call to ps
+// elsewhere, and the start time, which is read from /proc on linux.
+//
+// Any error returned is a *ProcError.
+func FindByPidFields(pid int, fields ...string) (*Process, error) {
+	proc, err := findByPidFields(pid, fields...)
+	if err != nil {
+		return nil, &ProcError{Op: "findbypidfields", Pid: pid, Err: err}
+	}
+	return proc, nil
+}
+
+func findByPidFields(pid int, fields ...string) (*Process, error) {
+	want := make(map[string]bool)
+	for _, field := range fields {
+		known := false
+		for _, psField := range psFields {
+			known = known || field == psField
+		}
+		if !known {
+			return nil, fmt.Errorf("error: unknown ps field %q", field)
+		}
+		want[field] = true
+	}
+
+	// The process's command is needed to extract it's args.
+	if want["command"] {
+		want["comm"] = true
+	}
+
+	proc := new(Process)
+
+	var err error
+	proc.Process, err = os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the list of fields to get from ps, such as uid=,tty=,comm=.
+	var psArgs []string
+	for _, field := range psFields {
+		if want[field] && field != "command" && (field != "lstart" || startTimeFromPs) {
+			psArgs = append(psArgs, field+"=")
+		}
+	}
+
+	if len(psArgs) > 0 {
+		// ps -o $FIELDS -p $PID
+		out, err := runOutput("ps", "-o", strings.Join(psArgs, ","), strconv.Itoa(pid))
+		if err != nil {
+			return nil, err
+		}
+
+		// next returns the next word from the rest of ps's output.
+		rest := strings.TrimSpace(string(out))
+		next := func() string {
+			rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+			i := strings.IndexFunc(rest, unicode.IsSpace)
+			if i < 0 {
+				i = len(rest)
+			}
+			word := rest[:i]
+			rest = rest[i:]
+			return word
+		}
+
+		for _, psArg := range psArgs {
+			switch strings.TrimSuffix(psArg, "=") {
+			case "uid":
+				proc.UID, err = strconv.Atoi(next())
+			case "ppid":
+				proc.PPid, err = strconv.Atoi(next())
+			case "rss":
+				// rss is reported in kilobytes.
+				var rss uint64
+				rss, err = strconv.ParseUint(next(), 10, 64)
+				proc.RSS = rss * 1024
+			case "%cpu":
+				proc.CPUPercent, err = strconv.ParseFloat(next(), 64)
+			case "state":
+				if state := next(); state != "" {
+					proc.RunState = State(state[0])
+				}
+			case "tty":
+				proc.Tty = next()
+			case "lstart":
+				lstart := strings.Join([]string{next(), next(), next(), next(), next()}, " ")
+				proc.StartTime, err = time.ParseInLocation("Mon Jan 2 15:04:05 2006",
+					lstart, time.Local)
+			case "comm":
+				proc.Cmd = strings.TrimSpace(rest)
+			}
+			if err != nil {
+				logf("parse ps fields %s for pid %d: %q: error: %v", psArg, pid, out, err)
+				return nil, err
+			}
+		}
+		logf("parse ps fields %s for pid %d: %q", strings.Join(psArgs, ","), pid, out)
+	}
+
+	// Get the process's args.
+	if want["command"] {
+		proc.Args, err = readArgs(pid, proc.Cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the process's start time.
+	if want["lstart"] && !startTimeFromPs {
+		proc.StartTime, err = processStartTime(pid)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return proc, nil
 }
+
+// psField returns the value of the ps field for the process with the
+// specified pid, with any surrounding white space trimmed.
+//
+// If there's no process with the specified pid, ErrProcNotRunning is returned.
+func psField(pid int, field string) (string, error) {
+	// ps -o $FIELD= -p $PID
+	out, err := runOutput("ps", "-o", field+"=", strconv.Itoa(pid))
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", ErrProcNotRunning
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// logf logs using Logf if it's set.
+func logf(format string, args ...interface{}) {
+	if Logf != nil {
+		Logf(format, args...)
+	}
+}
+
+// runOutput runs the ps or lsof command from toolCommand and returns it's
+// output, logging the command and how long it took to run.
+func runOutput(name string, arg ...string) ([]byte, error) {
+	start := time.Now()
+	out, err := toolCommand(name, arg...).Output()
+	logf("exec %s %s: %d bytes in %s, error: %v", name, strings.Join(arg, " "),
+		len(out), time.Since(start), err)
+	return out, err
+}
+
+// toolCommand returns the *exec.Cmd from execCommand for running ps or lsof
+// in the C locale, so that their headers and dates, such as ps's lstart,
+// are in the format that's parsed no matter what the user's locale is.
+func toolCommand(name string, arg ...string) *exec.Cmd {
+	c := execCommand(name, arg...)
+	if c.Env == nil {
+		c.Env = os.Environ()
+	}
+	// LC_ALL overrides every other locale variable, and the last value of a
+	// variable in Env is the one that's used.
+	c.Env = append(c.Env, "LC_ALL=C")
+	return c
+}
+
+// closeFiles closes each of the files.
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// readArgs returns the args of the process with the specified pid and comm,
+// using ArgParser if it has been replaced.
+func readArgs(pid int, comm string) ([]string, error) {
+	// Funcs can't be compared directly, so compare their code pointers.
+	if ArgParser == nil || reflect.ValueOf(ArgParser).Pointer() == reflect.ValueOf(defaultArgParser).Pointer() {
+		return processArgs(pid, comm)
+	}
+	command, err := psField(pid, "command")
+	if err != nil {
+		return nil, err
+	}
+	return ArgParser(command, comm), nil
+}
+
+// commandArgs returns the args from a process's full command, which are
+// whatever follows the process's comm, split by splitArgs.
+func commandArgs(command, comm string) []string {
+	split := strings.SplitAfterN(command, comm, 2)
+	if len(split) < 2 {
+		return nil
+	}
+	return splitArgs(split[1])
+}
+
+// splitArgs splits s into args around each instance of one or more
+// consecutive white space characters, keeping any single or double quoted
+// groups together as a single arg with their quotes removed.
+func splitArgs(s string) []string {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
@@ -0,0 +1,21 @@
+package process
+
+import "syscall"
+
+// The darwin setpriority which and prio values for background scheduling,
+// from sys/resource.h.
+const (
+	prioDarwinProcess = 4
+	prioDarwinBG      = 0x1000
+)
+
+// setBackground puts the process with the specified pid in the darwin
+// background scheduling class if bg is true, or otherwise takes it out of it.
+// The scheduling class doesn't change the nice value, so restore is unused.
+func setBackground(pid int, bg bool, restore int) (int, error) {
+	prio := 0
+	if bg {
+		prio = prioDarwinBG
+	}
+	return 0, syscall.Setpriority(prioDarwinProcess, pid, prio)
+}
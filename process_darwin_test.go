@@ -0,0 +1,23 @@
+package process
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestSetBackground(t *testing.T) {
+	c := exec.Command("sleep", "5")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer c.Process.Kill()
+
+	proc := &Process{Process: c.Process}
+	if err := proc.SetBackground(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.SetBackground(false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,427 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// processArgs returns the args of the process with the specified pid.
+//
+// On linux the args are read from /proc/<pid>/cmdline, which separates each
+// arg with a NUL byte, so args containing spaces are preserved exactly.
+func processArgs(pid int, comm string) ([]string, error) {
+	cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return nil, err
+	}
+	args := strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+	return args[1:], nil
+}
+
+// processArgv0 returns the argv[0] of the process with the specified pid,
+// read from the first arg in /proc/<pid>/cmdline.
+func processArgv0(pid int, comm string) (string, error) {
+	cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return "", err
+	}
+	argv0, _, _ := strings.Cut(string(cmdline), "\x00")
+	return argv0, nil
+}
+
+// processCwd returns the cwd of the process with the specified pid, read
+// exactly from the /proc/<pid>/cwd symlink.
+//
+// The link's target is relative to the process's mount namespace, so for a
+// process in a container it might not exist as is on the host.
+func processCwd(pid int) (string, error) {
+	return os.Readlink("/proc/" + strconv.Itoa(pid) + "/cwd")
+}
+
+// processRoot returns the root directory of the process with the specified
+// pid, read from the /proc/<pid>/root symlink.
+func processRoot(pid int) (string, error) {
+	root, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/root")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return "", err
+	}
+	return root, nil
+}
+
+// processExe returns the path of the executable of the process with the
+// specified pid, read from the /proc/<pid>/exe symlink.
+func processExe(pid int) (string, error) {
+	return os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+}
+
+// processStdStreams returns where fds 0, 1 and 2 of the process with the
+// specified pid point to, from the /proc/<pid>/fd symlinks, which name
+// anything that isn't a file in the form type:[inode], such as pipe:[12345].
+func processStdStreams(pid int) (streams [3]string, err error) {
+	procDir := "/proc/" + strconv.Itoa(pid)
+	if _, err := os.Stat(procDir); err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return streams, err
+	}
+
+	for fd := range streams {
+		target, err := os.Readlink(procDir + "/fd/" + strconv.Itoa(fd))
+		if err != nil {
+			// The fd is closed.
+			if os.IsNotExist(err) {
+				continue
+			}
+			return streams, err
+		}
+		streams[fd] = target
+	}
+	return streams, nil
+}
+
+// processNumFDs returns the number of entries in /proc/<pid>/fd for the
+// process with the specified pid.
+func processNumFDs(pid int) (int, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/fd")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	// Only the names are read, which avoids an lstat of every fd.
+	names, err := f.Readdirnames(-1)
+	return len(names), err
+}
+
+// openFilePids returns the pids of the processes that have the file at path
+// open, found by scanning the /proc/<pid>/fd symlinks of every process.
+func openFilePids(path string) ([]int, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	// The fd symlinks point to the file's real path.
+	if realPath, err := filepath.EvalSymlinks(path); err == nil {
+		path = realPath
+	}
+
+	return fdPids(func(target string) bool {
+		return target == path
+	})
+}
+
+// portPids returns the pids of the processes with a socket listening on
+// the port, found from the socket inodes in /proc/net/<proto> and
+// /proc/net/<proto>6 and then the fds of every process.
+func portPids(proto string, port int) ([]int, error) {
+	sockets := make(map[string]bool)
+	for _, name := range []string{proto, proto + "6"} {
+		table, err := os.ReadFile("/proc/net/" + name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		// Each line after the header is in the form
+		// sl local_address rem_address st ... uid timeout inode, with the
+		// addresses in the form hex-ip:hex-port.
+		for _, line := range strings.Split(string(table), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 10 {
+				continue
+			}
+			_, localPort, _ := strings.Cut(fields[1], ":")
+			if p, err := strconv.ParseUint(localPort, 16, 16); err != nil || int(p) != port {
+				continue
+			}
+			// Only tcp sockets in the listen state, 0A, are listening.
+			if proto == "tcp" && fields[3] != "0A" {
+				continue
+			}
+			sockets["socket:["+fields[9]+"]"] = true
+		}
+	}
+	if len(sockets) == 0 {
+		return nil, nil
+	}
+
+	return fdPids(func(target string) bool {
+		return sockets[target]
+	})
+}
+
+// fdPids returns the pids of the processes that have an fd whose
+// /proc/<pid>/fd symlink's target matches.
+//
+// Processes whose fds can't be read are skipped.
+func fdPids(match func(target string) bool) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := "/proc/" + entry.Name() + "/fd"
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(fdDir + "/" + fd.Name()); err == nil && match(target) {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return pids, nil
+}
+
+// readCredentials reads the real and effective user and group ids of the
+// process with the specified pid from the Uid and Gid lines of
+// /proc/<pid>/status, which list the real, effective, saved and filesystem
+// ids in that order.
+func readCredentials(pid int) (ruid, euid, rgid, egid int, err error) {
+	status, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return 0, 0, 0, 0, err
+	}
+
+	// ids parses the real and effective ids from a Uid or Gid line.
+	ids := func(line string) (real, effective int, err error) {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return 0, 0, fmt.Errorf("error: invalid status line: %q", line)
+		}
+		if real, err = strconv.Atoi(fields[1]); err != nil {
+			return 0, 0, err
+		}
+		effective, err = strconv.Atoi(fields[2])
+		return real, effective, err
+	}
+
+	foundUid, foundGid := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "Uid:"):
+			if ruid, euid, err = ids(line); err != nil {
+				return 0, 0, 0, 0, err
+			}
+			foundUid = true
+		case strings.HasPrefix(line, "Gid:"):
+			if rgid, egid, err = ids(line); err != nil {
+				return 0, 0, 0, 0, err
+			}
+			foundGid = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if !foundUid || !foundGid {
+		return 0, 0, 0, 0, fmt.Errorf("error: no Uid or Gid in status for pid %d", pid)
+	}
+
+	return ruid, euid, rgid, egid, nil
+}
+
+// sysPidfdOpen is the pidfd_open syscall number, which is the same on every
+// architecture, but isn't defined by the syscall package.
+const sysPidfdOpen = 434
+
+// waitPidfd blocks until the process with the specified pid has exited, ctx
+// is done or closed is closed, by polling a pidfd for the process. The pidfd
+// is polled with timeouts from DefaultPollConfig so that ctx and closed are
+// checked in between.
+//
+// If the kernel doesn't support pidfd_open, ErrUnsupported is returned.
+func waitPidfd(ctx context.Context, pid int, closed <-chan struct{}) error {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	switch errno {
+	case 0:
+	case syscall.ENOSYS:
+		return ErrUnsupported
+	case syscall.ESRCH:
+		// The process has already exited and been reaped.
+		return nil
+	default:
+		return errno
+	}
+	defer syscall.Close(int(fd))
+
+	// struct pollfd { int fd; short events; short revents; }
+	pollFd := struct {
+		fd      int32
+		events  int16
+		revents int16
+	}{fd: int32(fd), events: 0x1} // POLLIN
+	next := DefaultPollConfig.backoff()
+	for {
+		// ppoll may change the timeout to the time that was left, so it's
+		// reset each time.
+		timeout := syscall.NsecToTimespec(int64(next()))
+		n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&pollFd)), 1,
+			uintptr(unsafe.Pointer(&timeout)), 0, 0, 0)
+		if errno != 0 && errno != syscall.EINTR {
+			return errno
+		}
+		if n > 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return ErrProcClosed
+		default:
+		}
+	}
+}
+
+// readOOMScoreAdj reads the oom score adjustment of the process with the
+// specified pid from /proc/<pid>/oom_score_adj.
+func readOOMScoreAdj(pid int) (int, error) {
+	adj, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/oom_score_adj")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(adj)))
+}
+
+// writeOOMScoreAdj writes adj to /proc/<pid>/oom_score_adj for the process
+// with the specified pid.
+func writeOOMScoreAdj(pid, adj int) error {
+	f, err := os.OpenFile("/proc/"+strconv.Itoa(pid)+"/oom_score_adj", os.O_WRONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return err
+	}
+	if _, err := f.WriteString(strconv.Itoa(adj)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readCgroups reads the cgroups of the process with the specified pid from
+// /proc/<pid>/cgroup, where each line is in the form
+// hierarchy-ID:controller-list:cgroup-path. The controller list is a comma
+// separated list for cgroup v1 and is empty for the cgroup v2 hierarchy.
+func readCgroups(pid int) (map[string]string, error) {
+	cgroup, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cgroup")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return nil, err
+	}
+
+	cgroups := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			cgroups[controller] = parts[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cgroups, nil
+}
+
+// setBackground sets the nice value of the process with the specified pid to
+// 19 if bg is true, returning the nice value it had before, or otherwise to
+// restore.
+func setBackground(pid int, bg bool, restore int) (int, error) {
+	if !bg {
+		return restore, syscall.Setpriority(syscall.PRIO_PROCESS, pid, restore)
+	}
+
+	// The nice value is field 19 of /proc/<pid>/stat.
+	fields, err := readStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	prev, err := strconv.Atoi(fields[19-3])
+	if err != nil {
+		return 0, err
+	}
+	return prev, syscall.Setpriority(syscall.PRIO_PROCESS, pid, 19)
+}
+
+// SetName sets the name of the current process as shown by ps, so the
+// current process can be found by it's name with FindByName.
+//
+// Linux truncates the name to 15 bytes.
+func SetName(name string) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// prctl(PR_SET_NAME) only names the calling thread, so it can only be used
+	// to name the process when called from the process's main thread.
+	// Otherwise write the name to /proc/self/comm, which names the main thread.
+	if syscall.Gettid() != os.Getpid() {
+		return os.WriteFile("/proc/self/comm", []byte(name), 0)
+	}
+
+	b, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, eno := syscall.Syscall(syscall.SYS_PRCTL,
+		syscall.PR_SET_NAME,
+		uintptr(unsafe.Pointer(b)),
+		0,
+	)
+	if eno != 0 {
+		return error(eno)
+	}
+	return nil
+}
+
+// getsid returns the session id of the process with the specified pid.
+func getsid(pid int) (int, error) {
+	sid, _, eno := syscall.RawSyscall(syscall.SYS_GETSID, uintptr(pid), 0, 0)
+	if eno != 0 {
+		return 0, eno
+	}
+	return int(sid), nil
+}
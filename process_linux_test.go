@@ -0,0 +1,728 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestFindByPidArgsWithSpaces(t *testing.T) {
+	// Start a shell with an arg containing a space. The trailing : stops the
+	// shell from exec'ing sleep in its place.
+	shCmd := exec.Command("sh", "-c", "sleep 5; :", "--msg=hello world")
+	if err := shCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer shCmd.Process.Kill()
+
+	proc, err := FindByPid(shCmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proc.Args) != 3 {
+		t.Fatalf("proc args incorrect, expected 3 args, found %d: %q",
+			len(proc.Args), proc.Args)
+	}
+
+	if proc.Args[2] != "--msg=hello world" {
+		t.Errorf("proc arg incorrect, expected %s, found %s",
+			"--msg=hello world", proc.Args[2])
+	}
+}
+
+func TestReconstruct(t *testing.T) {
+	argv := []string{"sh", "-c", "sleep 5; :", "--msg=hello world"}
+	shCmd := exec.Command(argv[0], argv[1:]...)
+	if err := shCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer shCmd.Process.Kill()
+
+	proc, err := FindByPid(shCmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reconstructed := proc.Reconstruct(); strings.Join(reconstructed, "\x00") != strings.Join(argv, "\x00") {
+		t.Errorf("proc argv incorrect, expected %q, found %q", argv, reconstructed)
+	}
+}
+
+func TestReconstructLongPath(t *testing.T) {
+	sleepPath, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run sleep by it's full path and with a name longer than the 15 bytes
+	// of it's comm, neither of which can be recovered from the comm.
+	longPath := filepath.Join(t.TempDir(), "a-very-long-sleep-command")
+	sleep, err := os.ReadFile(sleepPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(longPath, sleep, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	argv := []string{longPath, "5"}
+	c := exec.Command(argv[0], argv[1:]...)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer c.Process.Kill()
+
+	proc, err := FindByPid(c.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reconstructed := proc.Reconstruct(); strings.Join(reconstructed, "\x00") != strings.Join(argv, "\x00") {
+		t.Errorf("proc argv incorrect, expected %q, found %q", argv, reconstructed)
+	}
+	if quoted, expected := proc.QuotedCommand(), shellQuote(longPath)+" 5"; quoted != expected {
+		t.Errorf("proc quoted command incorrect, expected %s, found %s", expected, quoted)
+	}
+}
+
+func TestFindByPidArgsWithNewline(t *testing.T) {
+	shCmd := exec.Command("sh", "-c", "sleep 5; :", "two\nlines")
+	if err := shCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer shCmd.Process.Kill()
+
+	proc, err := FindByPid(shCmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proc.Args) != 3 || proc.Args[2] != "two\nlines" {
+		t.Errorf("proc args incorrect, expected last arg %q, found %q",
+			"two\nlines", proc.Args)
+	}
+}
+
+func TestSetName(t *testing.T) {
+	comm, err := os.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetName(strings.TrimSpace(string(comm)))
+
+	if err := SetName("proctest"); err != nil {
+		t.Fatal(err)
+	}
+
+	comm, err = os.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := strings.TrimSpace(string(comm)); name != "proctest" {
+		t.Errorf("process name incorrect, expected proctest, found %s", name)
+	}
+}
+
+func TestStartChroot(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("chroot requires root privileges")
+	}
+
+	// A dynamically linked test binary, such as one built with -race or cgo,
+	// can't run without it's ELF interpreter, which isn't in the chroot.
+	bin, err := elf.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bin.Close()
+	for _, prog := range bin.Progs {
+		if prog.Type == elf.PT_INTERP {
+			t.Skip("the test binary is dynamically linked")
+		}
+	}
+
+	// Create a minimal root directory containing only the test binary, which
+	// is run as a helper process.
+	root := t.TempDir()
+	testBinary, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "helper"), testBinary, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check whether the current working directory is visible from inside
+	// the chroot.
+	proc := helperProcess("/helper", "exists", cwd)
+	proc.Chroot = root
+
+	var stdout bytes.Buffer
+	if err := proc.Start(false, nil, &stdout, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := strings.TrimSpace(stdout.String()); out != "missing" {
+		t.Errorf("expected %s to be missing inside chroot, found %s", cwd, out)
+	}
+}
+
+// ioctl calls the ioctl syscall for fd with the specified request and arg.
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, eno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if eno != 0 {
+		return eno
+	}
+	return nil
+}
+
+// openPty opens a new pseudo terminal, returning it's master and slave.
+func openPty(t *testing.T) (master, slave *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pty available:", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	var ptn uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&ptn)); err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptn),
+		os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+
+	return master, slave
+}
+
+func TestInjectTty(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	// Turn off signals and line buffering, so the Ctrl-C is read as a byte.
+	var termios syscall.Termios
+	if err := ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&termios)); err != nil {
+		t.Fatal(err)
+	}
+	termios.Lflag &^= syscall.ISIG | syscall.ICANON | syscall.ECHO
+	if err := ioctl(slave.Fd(), syscall.TCSETS, unsafe.Pointer(&termios)); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	// Injecting nothing should do nothing, even for an invalid fd.
+	if err := proc.InjectTty(^uintptr(0), nil); err != nil {
+		t.Errorf("expected injecting nothing to succeed, found %v", err)
+	}
+
+	err := proc.InjectTty(slave.Fd(), []byte{0x03})
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EIO) {
+		t.Skip("tty injection isn't permitted:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1)
+	if _, err := slave.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 0x03 {
+		t.Errorf("injected byte incorrect, expected 0x03, found %#x", b[0])
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	ruid, euid, rgid, egid, err := proc.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ruid != os.Getuid() || euid != os.Geteuid() {
+		t.Errorf("proc uids incorrect, expected %d %d, found %d %d",
+			os.Getuid(), os.Geteuid(), ruid, euid)
+	}
+	if rgid != os.Getgid() || egid != os.Getegid() {
+		t.Errorf("proc gids incorrect, expected %d %d, found %d %d",
+			os.Getgid(), os.Getegid(), rgid, egid)
+	}
+}
+
+func TestStartTtyWaitsForProcess(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	if err := (&Process{Process: &os.Process{Pid: os.Getpid()}}).InjectTty(slave.Fd(), []byte{'\n'}); err != nil {
+		t.Skip("tty injection isn't permitted:", err)
+	}
+
+	// Only show the process in ps on the third call, as if it's slow to start.
+	calls := 0
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		calls++
+		output := "  PID TTY          TIME CMD\n"
+		if calls == 3 {
+			output += " 4242 pts/0    00:00:00 slowstart\n"
+		}
+		return exec.Command("printf", "%s", output)
+	}
+	defer func() { execCommand = exec.Command }()
+
+	defer func(attempts int, interval time.Duration) {
+		StartTtyAttempts, StartTtyInterval = attempts, interval
+	}(StartTtyAttempts, StartTtyInterval)
+	StartTtyAttempts, StartTtyInterval = 5, time.Millisecond
+
+	proc := &Process{Cmd: "slowstart", Tty: "pts/0"}
+	if err := proc.StartTty(slave.Fd(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != 4242 {
+		t.Errorf("proc pid is incorrect, expected 4242, found %d", proc.Pid)
+	}
+
+	// The process never shows up in ps after the third call.
+	if err := proc.StartTty(slave.Fd(), nil); !errors.Is(err, ErrRestartTimeout) {
+		t.Errorf("expected ErrRestartTimeout, found %v", err)
+	}
+}
+
+func TestStartTtySelf(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	if err := (&Process{Process: &os.Process{Pid: os.Getpid()}}).InjectTty(slave.Fd(), []byte{'\n'}); err != nil {
+		t.Skip("tty injection isn't permitted:", err)
+	}
+
+	tty := strings.TrimPrefix(slave.Name(), "/dev/")
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		return exec.Command("printf", "%s", "  PID TTY          TIME CMD\n"+
+			" 4242 "+tty+"    00:00:00 selfstart\n")
+	}
+	defer func() { execCommand = exec.Command }()
+
+	proc := &Process{Cmd: "selfstart", Tty: tty}
+	if err := proc.StartTtySelf(nil); err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != 4242 {
+		t.Errorf("proc pid is incorrect, expected 4242, found %d", proc.Pid)
+	}
+
+	// The command is injected into the tty, so it can be read back from the
+	// master.
+	buf := make([]byte, 64)
+	n, err := master.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf[:n]), "selfstart") {
+		t.Errorf("expected selfstart to be injected into the tty, found %q", buf[:n])
+	}
+
+	notInTty := &Process{Cmd: "selfstart", Tty: "??"}
+	if err := notInTty.StartTtySelf(nil); err != ErrProcNotInTty {
+		t.Errorf("expected ErrProcNotInTty, found %v", err)
+	}
+}
+
+func TestSetBackground(t *testing.T) {
+	c := exec.Command("sleep", "5")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer c.Process.Kill()
+
+	// Start the sleep with a nice value of 5, so SetBackground(false) must
+	// restore it rather than reset it to 0.
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, c.Process.Pid, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Process{Process: c.Process}
+	for _, test := range []struct {
+		bg   bool
+		nice string
+	}{
+		{true, "19"},
+		{true, "19"},
+		{false, "5"},
+	} {
+		// Lowering the nice value back down requires root privileges.
+		if !test.bg && os.Geteuid() != 0 {
+			t.Skip("restoring the nice value requires root privileges")
+		}
+		if err := proc.SetBackground(test.bg); err != nil {
+			t.Fatal(err)
+		}
+
+		// The nice value is field 19 of /proc/<pid>/stat.
+		fields, err := readStat(proc.Pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fields[19-3] != test.nice {
+			t.Errorf("proc nice incorrect, expected %s, found %s", test.nice, fields[19-3])
+		}
+	}
+}
+
+func TestTtySize(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	winsize := [4]uint16{24, 80, 0, 0}
+	if err := ioctl(master.Fd(), syscall.TIOCSWINSZ, unsafe.Pointer(&winsize)); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Process{Tty: strings.TrimPrefix(slave.Name(), "/dev/")}
+	rows, cols, err := proc.TtySize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 24 || cols != 80 {
+		t.Errorf("proc tty size incorrect, expected 24x80, found %dx%d", rows, cols)
+	}
+
+	notInTty := &Process{Tty: "??"}
+	if _, _, err := notInTty.TtySize(); err != ErrProcNotInTty {
+		t.Errorf("expected ErrProcNotInTty, found %v", err)
+	}
+}
+
+func TestIsForeground(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	// Start a sleep in a new session with the pty as it's controlling tty,
+	// which makes it the tty's foreground process group.
+	c := exec.Command("sleep", "5")
+	c.Stdin = slave
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer c.Process.Kill()
+
+	proc := &Process{Process: c.Process}
+	foreground, err := proc.IsForeground()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !foreground {
+		t.Error("expected proc to be in the foreground")
+	}
+
+	// ps reports a process without a controlling tty as being in tty ?.
+	if currentTty == "?" {
+		self := &Process{Process: &os.Process{Pid: os.Getpid()}}
+		if _, err := self.IsForeground(); err != ErrProcNotInTty {
+			t.Errorf("expected ErrProcNotInTty, found %v", err)
+		}
+	}
+}
+
+func TestCgroups(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	cgroups, err := proc.Cgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cgroups) == 0 {
+		t.Fatal("expected at least one cgroup")
+	}
+
+	// Either the cgroup v2 hierarchy or a cgroup v1 controller is expected.
+	_, v2 := cgroups[""]
+	_, v1 := cgroups["memory"]
+	if !v2 && !v1 {
+		t.Errorf("expected a cgroup v2 or v1 memory entry, found %v", cgroups)
+	}
+}
+
+func TestWaitExitPidfd(t *testing.T) {
+	// The sleep is reparented once sh exits, so it isn't a child of this
+	// process and can't be waited on.
+	out, err := exec.Command("sh", "-c", "sleep 0.5 >/dev/null & echo $!").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := &Process{Process: &os.Process{Pid: pid}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The sleep must still be running when the wait starts and be gone by the
+	// time it returns, which it must do before ctx's deadline.
+	if err := proc.HealthCheck(); err != nil {
+		t.Fatalf("expected sleep to be running before waiting, found %v", err)
+	}
+	if err := proc.WaitExitPidfd(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.HealthCheck(); err == nil {
+		t.Error("expected sleep to no longer be running")
+	}
+}
+
+func TestStdStreams(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "stdout")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+
+	// A nil stdin is /dev/null and a buffer for stderr is read from a pipe.
+	var stderrBuf bytes.Buffer
+	notify := make(chan struct{})
+	go proc.Start(false, nil, f, &stderrBuf, notify)
+	<-notify
+	defer proc.Kill()
+
+	stdin, stdout, stderr, err := proc.StdStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdin != "/dev/null" {
+		t.Errorf("proc stdin incorrect, expected /dev/null, found %s", stdin)
+	}
+	if stdout != path {
+		t.Errorf("proc stdout incorrect, expected %s, found %s", path, stdout)
+	}
+	if !strings.HasPrefix(stderr, "pipe:[") {
+		t.Errorf("proc stderr incorrect, expected a pipe, found %s", stderr)
+	}
+}
+
+func TestOOMScoreAdj(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	adj, err := proc.OOMScoreAdj()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adj < -1000 || adj > 1000 {
+		t.Fatalf("oom score adjustment out of range, found %d", adj)
+	}
+
+	// Raising a process's own adjustment is always permitted, but lowering it
+	// again to restore it isn't without root privileges.
+	if adj == 1000 || os.Geteuid() != 0 {
+		return
+	}
+	defer proc.SetOOMScoreAdj(adj)
+
+	if err := proc.SetOOMScoreAdj(adj + 1); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := proc.OOMScoreAdj(); err != nil {
+		t.Fatal(err)
+	} else if found != adj+1 {
+		t.Errorf("oom score adjustment incorrect, expected %d, found %d", adj+1, found)
+	}
+}
+
+func TestSetOOMScoreAdj(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	for _, adj := range []int{-1001, 1001} {
+		if err := proc.SetOOMScoreAdj(adj); !errors.Is(err, ErrInvalidOOMScoreAdj) {
+			t.Errorf("SetOOMScoreAdj(%d) expected ErrInvalidOOMScoreAdj, found %v", adj, err)
+		}
+	}
+
+	adj, err := proc.OOMScoreAdj()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adj > 100 && os.Geteuid() != 0 {
+		t.Skip("lowering the oom score adjustment requires root privileges")
+	}
+	defer proc.SetOOMScoreAdj(adj)
+
+	if err := proc.SetOOMScoreAdj(100); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile("/proc/self/oom_score_adj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := strings.TrimSpace(string(b)); found != "100" {
+		t.Errorf("oom score adjustment incorrect, expected 100, found %s", found)
+	}
+}
+
+func TestStartUmask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "created")
+
+	umask := 0077
+	proc := &Process{Cmd: "touch", Args: []string{path}, Umask: &umask}
+	if err := proc.Start(false, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// touch creates files with mode 0666 before the umask is applied.
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("created file mode incorrect, expected %o, found %o", 0600, mode)
+	}
+}
+
+func TestStartUmaskNotFound(t *testing.T) {
+	umask := 0077
+	proc := &Process{Cmd: "not-a-real-command", Umask: &umask}
+	if err := proc.Start(false, nil, nil, nil, nil); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected exec.ErrNotFound, found %v", err)
+	}
+}
+
+func TestRoot(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	root, err := proc.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != "/" {
+		t.Errorf("proc root incorrect, expected /, found %s", root)
+	}
+}
+
+func TestExePath(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	path, err := proc.ExePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(path) != filepath.Base(os.Args[0]) {
+		t.Errorf("proc exe path incorrect, expected it to end in %s, found %s",
+			filepath.Base(os.Args[0]), path)
+	}
+}
+
+func TestExeChecksum(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+
+	checksum, err := proc.ExeChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exe, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(exe)
+	if expected := hex.EncodeToString(sum[:]); checksum != expected {
+		t.Errorf("proc exe checksum incorrect, expected %s, found %s", expected, checksum)
+	}
+}
+
+func TestIOStats(t *testing.T) {
+	// Write a megabyte to a file and then wait for stdin to close.
+	path := filepath.Join(t.TempDir(), "written")
+	c := exec.Command("sh", "-c", `head -c 1048576 /dev/zero > "$0"; echo written; read x`, path)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer stdin.Close()
+
+	var written string
+	if _, err := fmt.Fscan(stdout, &written); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Process{Process: c.Process}
+	_, writeBytes, err := proc.IOStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if writeBytes < 1<<20 {
+		t.Errorf("expected proc to have written at least %d bytes, found %d", 1<<20, writeBytes)
+	}
+}
+
+func TestSampleCPU(t *testing.T) {
+	c := exec.Command("sh", "-c", "while :; do :; done")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer c.Process.Kill()
+
+	proc := &Process{Process: c.Process}
+	percent, err := proc.SampleCPU(500 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if percent < 20 {
+		t.Errorf("expected busy proc to use at least 20%% cpu, found %.1f%%", percent)
+	}
+}
@@ -0,0 +1,256 @@
+//go:build !linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// processArgs returns the args of the process with the specified pid.
+//
+// ps only reports a process's full command as a single string, so the args
+// are extracted from it by commandArgs. ps separates args with spaces and
+// doesn't escape white space within args, such as newlines, so an arg
+// containing white space that isn't quoted is split into multiple args.
+func processArgs(pid int, comm string) ([]string, error) {
+	// ps -o command= -p $PID
+	pidCommandEq, err := runOutput("ps", "-o", "command=", strconv.Itoa(pid))
+	if err != nil {
+		return nil, err
+	}
+	return commandArgs(string(pidCommandEq), comm), nil
+}
+
+// processArgv0 returns the argv[0] of the process with the specified pid,
+// which is the start of the process's full command up to the end of it's
+// comm, the same as commandArgs takes the args to be what follows it.
+func processArgv0(pid int, comm string) (string, error) {
+	// ps -o command= -p $PID
+	pidCommandEq, err := runOutput("ps", "-o", "command=", strconv.Itoa(pid))
+	if err != nil {
+		return "", err
+	}
+	split := strings.SplitAfterN(strings.TrimSpace(string(pidCommandEq)), comm, 2)
+	if len(split) < 2 {
+		return "", nil
+	}
+	return split[0], nil
+}
+
+// processCwd returns the cwd of the process with the specified pid.
+//
+// The cwd is found using lsof's field output, where the name field is the
+// remainder of it's line, so a cwd containing any white space is preserved
+// exactly.
+func processCwd(pid int) (string, error) {
+	// lsof -a -d cwd -Fn -p $PID
+	lsofOutput, err := runOutput("lsof", "-a", "-d", "cwd", "-Fn", "-p", strconv.Itoa(pid))
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(lsofOutput))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "n") {
+			return line[1:], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// processExe returns the path of the executable of the process with the
+// specified pid, from the name field of lsof's txt entries, where the first
+// entry is the executable.
+func processExe(pid int) (string, error) {
+	// lsof -a -d txt -Fn -p $PID
+	lsofOutput, err := runOutput("lsof", "-a", "-d", "txt", "-Fn", "-p", strconv.Itoa(pid))
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(lsofOutput))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "n") {
+			return line[1:], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("error: no executable found for pid %d", pid)
+}
+
+// processStdStreams returns where fds 0, 1 and 2 of the process with the
+// specified pid point to, found using lsof's fd, type and name fields. A pipe
+// or socket is labelled with it's type, such as pipe:[0x1234], to match the
+// way linux names them.
+func processStdStreams(pid int) (streams [3]string, err error) {
+	// lsof exits unsuccessfully both for a process that's gone and for one
+	// with none of the fds open, so check that the process is running first.
+	if syscall.Kill(pid, 0) == syscall.ESRCH {
+		return streams, ErrProcNotRunning
+	}
+
+	// lsof -a -d 0-2 -Fftn -p $PID
+	lsofOutput, err := runOutput("lsof", "-a", "-d", "0-2", "-Fftn", "-p", strconv.Itoa(pid))
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return streams, err
+	}
+
+	fd, fileType := -1, ""
+	scanner := bufio.NewScanner(bytes.NewReader(lsofOutput))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		switch value := line[1:]; line[0] {
+		case 'f':
+			if fd, err = strconv.Atoi(value); err != nil || fd > 2 {
+				fd = -1
+			}
+		case 't':
+			fileType = value
+		case 'n':
+			if fd < 0 {
+				continue
+			}
+			switch fileType {
+			case "PIPE", "FIFO":
+				if !strings.HasPrefix(value, "/") {
+					value = "pipe:[" + value + "]"
+				}
+			case "unix", "IPv4", "IPv6":
+				value = "socket:[" + value + "]"
+			}
+			streams[fd] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return streams, err
+	}
+	return streams, nil
+}
+
+// processNumFDs returns the number of file descriptors that lsof lists for
+// the process with the specified pid, which are those with a numeric fd
+// field, as opposed to entries such as cwd and txt.
+func processNumFDs(pid int) (int, error) {
+	if syscall.Kill(pid, 0) == syscall.ESRCH {
+		return 0, ErrProcNotRunning
+	}
+
+	// lsof -Ff -p $PID
+	lsofOutput, err := runOutput("lsof", "-Ff", "-p", strconv.Itoa(pid))
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return 0, err
+	}
+
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(lsofOutput))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "f") {
+			continue
+		}
+		if _, err := strconv.Atoi(line[1:]); err == nil {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// openFilePids returns the pids of the processes that have the file at path
+// open, found using lsof.
+func openFilePids(path string) ([]int, error) {
+	// lsof -t -- $PATH
+	return lsofPids("-t", "--", path)
+}
+
+// portPids returns the pids of the processes with a socket listening on
+// the port, found using lsof.
+func portPids(proto string, port int) ([]int, error) {
+	addr := proto + ":" + strconv.Itoa(port)
+	if proto == "tcp" {
+		// lsof -t -a -i tcp:$PORT -sTCP:LISTEN
+		return lsofPids("-t", "-a", "-i", addr, "-sTCP:LISTEN")
+	}
+	// lsof -t -i udp:$PORT
+	return lsofPids("-t", "-i", addr)
+}
+
+// lsofPids runs lsof with the specified args, which must include -t for
+// lsof's terse output of one pid per line, and returns the pids.
+//
+// lsof exits unsuccessfully when it finds no processes or can't read some of
+// them, so any pids it does output are still returned.
+func lsofPids(args ...string) ([]int, error) {
+	lsofOutput, err := runOutput("lsof", args...)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, err
+	}
+
+	var pids []int
+	scanner := bufio.NewScanner(bytes.NewReader(lsofOutput))
+	for scanner.Scan() {
+		if pid, err := strconv.Atoi(strings.TrimSpace(scanner.Text())); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, scanner.Err()
+}
+
+// readCredentials reads the real and effective user and group ids of the
+// process with the specified pid, which is only supported on linux.
+func readCredentials(pid int) (ruid, euid, rgid, egid int, err error) {
+	return 0, 0, 0, 0, ErrUnsupported
+}
+
+// processRoot returns the root directory of the process with the specified
+// pid, which is only supported on linux.
+func processRoot(pid int) (string, error) {
+	return "", ErrUnsupported
+}
+
+// readCgroups reads the cgroups of the process with the specified pid, which
+// is only supported on linux.
+func readCgroups(pid int) (map[string]string, error) {
+	return nil, ErrUnsupported
+}
+
+// waitPidfd waits on a pidfd for the process with the specified pid to exit,
+// which is only supported on linux.
+func waitPidfd(ctx context.Context, pid int, closed <-chan struct{}) error {
+	return ErrUnsupported
+}
+
+// readOOMScoreAdj reads the oom score adjustment of the process with the
+// specified pid, which is only supported on linux.
+func readOOMScoreAdj(pid int) (int, error) {
+	return 0, ErrUnsupported
+}
+
+// writeOOMScoreAdj sets the oom score adjustment of the process with the
+// specified pid, which is only supported on linux.
+func writeOOMScoreAdj(pid, adj int) error {
+	return ErrUnsupported
+}
+
+// SetName sets the name of the current process as shown by ps.
+//
+// SetName is only supported on linux and returns ErrUnsupported elsewhere.
+func SetName(name string) error {
+	return ErrUnsupported
+}
+
+// getsid returns the session id of the process with the specified pid.
+func getsid(pid int) (int, error) {
+	return syscall.Getsid(pid)
+}
@@ -1,13 +1,21 @@
 package process
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 var pid int
@@ -15,6 +23,12 @@ var currentTty, cwd, cmd, fullCommand string
 var args []string
 
 func init() {
+	// The helper process doesn't need any of the values below, and might not
+	// be able to run ps to get them.
+	if os.Getenv("PROCESS_TEST_HELPER") != "" {
+		return
+	}
+
 	pid = os.Getpid()
 
 	ttyBytes, err := exec.Command("ps", "-o", "tty=", strconv.Itoa(pid)).Output()
@@ -39,6 +53,61 @@ func init() {
 	}
 }
 
+// TestHelperProcess isn't a real test. It's run as a child process by other
+// tests, with the PROCESS_TEST_HELPER environment variable set to the name
+// of what the child process should do.
+func TestHelperProcess(t *testing.T) {
+	helperArgs := os.Args
+	for i, arg := range os.Args {
+		if arg == "--" {
+			helperArgs = os.Args[i+1:]
+			break
+		}
+	}
+
+	switch os.Getenv("PROCESS_TEST_HELPER") {
+	case "":
+		return
+	case "exists":
+		// Print whether the path in the first arg exists.
+		if _, err := os.Stat(helperArgs[0]); err != nil {
+			fmt.Println("missing")
+		} else {
+			fmt.Println("exists")
+		}
+	case "grow":
+		// Grow the heap by the number of megabytes in the first arg and
+		// keep it in use until killed.
+		mb, _ := strconv.Atoi(helperArgs[0])
+		heap := make([]byte, mb<<20)
+		for i := range heap {
+			heap[i] = 1
+		}
+		for {
+			time.Sleep(time.Second)
+			heap[0]++
+		}
+	case "busy":
+		// Busy loop for the number of milliseconds in the first arg and
+		// then idle until killed.
+		ms, _ := strconv.Atoi(helperArgs[0])
+		for end := time.Now().Add(time.Duration(ms) * time.Millisecond); time.Now().Before(end); {
+		}
+		time.Sleep(time.Hour)
+	}
+	os.Exit(0)
+}
+
+// helperProcess returns a Process that runs the test binary at path as a
+// helper process, doing what helper describes, with the specified args.
+func helperProcess(path, helper string, args ...string) *Process {
+	return &Process{
+		Cmd:  path,
+		Args: append([]string{"-test.run=^TestHelperProcess$", "--"}, args...),
+		Env:  append(os.Environ(), "PROCESS_TEST_HELPER="+helper),
+	}
+}
+
 func TestFindByPid(t *testing.T) {
 	proc, err := FindByPid(pid)
 	if err != nil {
@@ -109,6 +178,58 @@ func TestFullCommand(t *testing.T) {
 	}
 }
 
+func TestQuotedCommand(t *testing.T) {
+	tests := []struct {
+		args   []string
+		quoted string
+	}{
+		{nil, "echo"},
+		{[]string{"plain", "--flag=1"}, "echo plain --flag=1"},
+		{[]string{"foo bar"}, "echo 'foo bar'"},
+		{[]string{"it's"}, `echo 'it'\''s'`},
+		{[]string{""}, "echo ''"},
+	}
+
+	for _, test := range tests {
+		proc := &Process{Cmd: "echo", Args: test.args}
+		if quoted := proc.QuotedCommand(); quoted != test.quoted {
+			t.Errorf("proc quoted command incorrect, expected %s, found %s", test.quoted, quoted)
+		}
+	}
+}
+
+func TestTtyDevice(t *testing.T) {
+	tests := []struct {
+		tty  string
+		path string
+	}{
+		{"pts/3", "/dev/pts/3"},
+		{"ttys001", "/dev/ttys001"},
+		{"s001", "/dev/ttys001"},
+		{"tty1", "/dev/tty1"},
+		{"/dev/pts/3", "/dev/pts/3"},
+	}
+
+	for _, test := range tests {
+		proc := &Process{Tty: test.tty}
+		path, err := proc.TtyDevice()
+		if err != nil {
+			t.Errorf("TtyDevice for %s error: %v", test.tty, err)
+			continue
+		}
+		if path != test.path {
+			t.Errorf("TtyDevice for %s incorrect, expected %s, found %s", test.tty, test.path, path)
+		}
+	}
+
+	for _, tty := range []string{"?", "??"} {
+		proc := &Process{Tty: tty}
+		if _, err := proc.TtyDevice(); err != ErrProcNotInTty {
+			t.Errorf("TtyDevice for %s expected ErrProcNotInTty, found %v", tty, err)
+		}
+	}
+}
+
 func TestFindProcess(t *testing.T) {
 	proc := &Process{
 		Cmd:  cmd,
@@ -124,3 +245,1825 @@ func TestFindProcess(t *testing.T) {
 		t.Errorf("proc pid is incorrect, expected %d, found %d", pid, proc.Pid)
 	}
 }
+
+func TestProcError(t *testing.T) {
+	// Start and wait for a process so it's no longer running.
+	trueCmd := exec.Command("true")
+	if err := trueCmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Process{Process: trueCmd.Process}
+
+	err := proc.HealthCheck()
+	if !errors.Is(err, ErrProcNotRunning) {
+		t.Errorf("expected error to be ErrProcNotRunning, found %v", err)
+	}
+
+	var procErr *ProcError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("expected error to be a *ProcError, found %T", err)
+	}
+
+	if procErr.Pid != trueCmd.Process.Pid {
+		t.Errorf("proc error pid incorrect, expected %d, found %d",
+			trueCmd.Process.Pid, procErr.Pid)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		args []string
+	}{
+		{"", nil},
+		{"-a -b", []string{"-a", "-b"}},
+		{"  -a \t -b  ", []string{"-a", "-b"}},
+		{`--msg="hello world" -v`, []string{"--msg=hello world", "-v"}},
+		{`'a  b' "c 'd'"`, []string{"a  b", "c 'd'"}},
+	}
+
+	for _, test := range tests {
+		args := splitArgs(test.in)
+		if len(args) != len(test.args) {
+			t.Errorf("splitArgs(%q) incorrect, expected %q, found %q",
+				test.in, test.args, args)
+			continue
+		}
+		for i := range args {
+			if args[i] != test.args[i] {
+				t.Errorf("splitArgs(%q) incorrect, expected %q, found %q",
+					test.in, test.args, args)
+				break
+			}
+		}
+	}
+}
+
+func TestVerifyIdentity(t *testing.T) {
+	proc, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.VerifyIdentity(); err != nil {
+		t.Errorf("expected identity to match, found %v", err)
+	}
+
+	// Make the process's command stale.
+	proc.Cmd = "not-the-real-command"
+
+	if err := proc.VerifyIdentity(); !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("expected ErrIdentityMismatch, found %v", err)
+	}
+}
+
+func TestVerifyIdentityStartTime(t *testing.T) {
+	proc, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A process with the same command at the same pid that started at a
+	// different time is a different process.
+	proc.StartTime = proc.StartTime.Add(-time.Hour)
+	if err := proc.VerifyIdentity(); !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("expected ErrIdentityMismatch, found %v", err)
+	}
+}
+
+func TestVerifyIdentityCmd(t *testing.T) {
+	sleepPath, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A command longer than linux's comm, which is truncated.
+	longPath := filepath.Join(t.TempDir(), "a-very-long-sleep-command")
+	sleep, err := os.ReadFile(sleepPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(longPath, sleep, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range []string{sleepPath, longPath} {
+		proc := &Process{Cmd: cmd, Args: []string{"5"}}
+
+		notify := make(chan struct{})
+		go proc.Start(false, nil, nil, nil, notify)
+		<-notify
+
+		if err := proc.VerifyIdentity(); err != nil {
+			t.Errorf("expected identity of %s to match, found %v", cmd, err)
+		}
+		proc.Kill()
+	}
+}
+
+func TestExists(t *testing.T) {
+	if !Exists(pid) {
+		t.Error("expected current process to exist")
+	}
+
+	// Start and reap a process so it no longer exists.
+	trueCmd := exec.Command("true")
+	if err := trueCmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(trueCmd.Process.Pid) {
+		t.Error("expected reaped process to not exist")
+	}
+
+	// Pid 1 always exists, even if it can't be signalled.
+	if !Exists(1) {
+		t.Error("expected pid 1 to exist")
+	}
+}
+
+func TestDone(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "exit 3"}}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+
+	state := <-proc.Done()
+	if state == nil {
+		t.Fatal("expected process state, found nil")
+	}
+
+	if state.ExitCode() != 3 {
+		t.Errorf("proc exit code incorrect, expected 3, found %d", state.ExitCode())
+	}
+}
+
+func TestForEach(t *testing.T) {
+	count := 0
+	foundSelf := false
+	err := ForEach(func(proc *Process) error {
+		count++
+		if proc.Pid == pid {
+			foundSelf = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count == 0 {
+		t.Error("expected at least one process")
+	}
+
+	if !foundSelf {
+		t.Errorf("expected to find current process with pid %d", pid)
+	}
+}
+
+func TestForEachStopsEarly(t *testing.T) {
+	errFound := errors.New("found")
+
+	found := false
+	calledAfterFound := false
+	err := ForEach(func(proc *Process) error {
+		if found {
+			calledAfterFound = true
+		}
+		if proc.Pid == pid {
+			found = true
+			return errFound
+		}
+		return nil
+	})
+	if err != errFound {
+		t.Errorf("expected error %v, found %v", errFound, err)
+	}
+
+	if calledAfterFound {
+		t.Error("expected ForEach to stop after fn returned an error")
+	}
+}
+
+func TestEachStopIteration(t *testing.T) {
+	for _, stop := range []error{
+		ErrStopIteration,
+		fmt.Errorf("found pid %d: %w", pid, ErrStopIteration),
+	} {
+		calls := 0
+		err := Each(func(proc *Process) error {
+			calls++
+			return stop
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if calls != 1 {
+			t.Errorf("expected fn to be called once for %v, found %d calls", stop, calls)
+		}
+	}
+}
+
+// waitZombie waits up to half a second for proc to become a zombie process.
+func waitZombie(proc *Process) {
+	for i := 0; i < 50; i++ {
+		if state, err := proc.State(); err == nil && state == StateZombie {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHealthCheckZombie(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("zombies are only reported as not running on linux")
+	}
+
+	// Start a child that exits straight away and isn't waited on.
+	c := exec.Command("true")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+
+	proc := &Process{Process: c.Process}
+	for i := 0; i < 50 && proc.HealthCheck() == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := proc.HealthCheck(); !errors.Is(err, ErrProcNotRunning) {
+		t.Errorf("expected ErrProcNotRunning for exited child, found %v", err)
+	}
+}
+
+func TestZombies(t *testing.T) {
+	// Start a child that exits straight away and isn't waited on.
+	c := exec.Command("true")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+
+	waitZombie(&Process{Process: c.Process})
+
+	zombies, err := Zombies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var zombie *Process
+	for _, proc := range zombies {
+		if proc.Pid == c.Process.Pid {
+			zombie = proc
+		}
+	}
+	if zombie == nil {
+		t.Fatalf("expected to find zombie with pid %d, found %v", c.Process.Pid, zombies)
+	}
+	if zombie.PPid != pid {
+		t.Errorf("zombie ppid incorrect, expected %d, found %d", pid, zombie.PPid)
+	}
+}
+
+func TestKillByName(t *testing.T) {
+	// Start two sleep processes and only confirm the first one.
+	sleep1 := exec.Command("sleep", "5")
+	if err := sleep1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sleep2 := exec.Command("sleep", "5")
+	if err := sleep2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sleep2.Process.Kill()
+
+	killed, err := KillByName("sleep", syscall.SIGTERM, func(proc *Process) bool {
+		return proc.Pid == sleep1.Process.Pid
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(killed) != 1 || killed[0] != sleep1.Process.Pid {
+		t.Fatalf("killed pids incorrect, expected [%d], found %v",
+			sleep1.Process.Pid, killed)
+	}
+
+	// Make sure the first sleep was killed and the second is still running.
+	if err := sleep1.Wait(); err == nil {
+		t.Error("expected first sleep to be killed")
+	}
+
+	proc := &Process{Process: sleep2.Process}
+	if err := proc.HealthCheck(); err != nil {
+		t.Error("expected second sleep to be running")
+	}
+}
+
+func TestKillByNameOpts(t *testing.T) {
+	var sleeps []*exec.Cmd
+	pids := make(map[int]bool)
+	for i := 0; i < 3; i++ {
+		sleep := exec.Command("sleep", "5")
+		if err := sleep.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer sleep.Process.Kill()
+		sleeps = append(sleeps, sleep)
+		pids[sleep.Process.Pid] = true
+	}
+
+	// Only confirm the sleeps started here, since there might be others.
+	killed, err := KillByNameOpts("sleep", syscall.SIGTERM, KillOpts{
+		Confirm: func(proc *Process) bool { return pids[proc.Pid] },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(killed) != len(sleeps) {
+		t.Errorf("killed pids incorrect, expected %d pids, found %v", len(sleeps), killed)
+	}
+	for _, sleep := range sleeps {
+		if err := sleep.Wait(); err == nil {
+			t.Errorf("expected sleep %d to be killed", sleep.Process.Pid)
+		}
+	}
+
+	// The current process is skipped without IncludeSelf, even though it
+	// matches it's own name.
+	self, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	killed, err = KillByNameOpts(self.Cmd, syscall.Signal(0), KillOpts{
+		Confirm: func(proc *Process) bool { return proc.Pid == pid },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(killed) != 0 {
+		t.Errorf("expected the current process to be skipped, found %v", killed)
+	}
+
+	killed, err = KillByNameOpts(self.Cmd, syscall.Signal(0), KillOpts{
+		Confirm:     func(proc *Process) bool { return proc.Pid == pid },
+		IncludeSelf: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(killed) != 1 || killed[0] != pid {
+		t.Errorf("killed pids incorrect, expected [%d], found %v", pid, killed)
+	}
+}
+
+func TestSuspendResume(t *testing.T) {
+	sleepCmd := exec.Command("sleep", "5")
+	if err := sleepCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sleepCmd.Process.Kill()
+
+	proc := &Process{Process: sleepCmd.Process}
+
+	// waitStopped waits for the process's stopped state to become stopped,
+	// since signals are delivered asynchronously.
+	waitStopped := func(stopped bool) {
+		for i := 0; i < 50; i++ {
+			isStopped, err := proc.IsStopped()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isStopped == stopped {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("expected process stopped to be %t", stopped)
+	}
+
+	if err := proc.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	waitStopped(true)
+
+	if err := proc.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitStopped(false)
+}
+
+func TestFindOwnedByMe(t *testing.T) {
+	procs, err := Find(FindOpts{OwnedByMe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foundSelf := false
+	for _, proc := range procs {
+		if proc.UID != os.Getuid() {
+			t.Errorf("proc uid incorrect, expected %d, found %d for pid %d",
+				os.Getuid(), proc.UID, proc.Pid)
+		}
+		if proc.Pid == pid {
+			foundSelf = true
+		}
+	}
+
+	if !foundSelf {
+		t.Errorf("expected to find current process with pid %d", pid)
+	}
+}
+
+func TestFindOwnedByMeExcludesRoot(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root owns the root-owned processes")
+	}
+
+	procs, err := Find(FindOpts{OwnedByMe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, proc := range procs {
+		if proc.UID == 0 {
+			t.Errorf("expected root-owned process %d to be excluded", proc.Pid)
+		}
+	}
+}
+
+func TestFromCmd(t *testing.T) {
+	dir := t.TempDir()
+
+	c := exec.Command("sleep", "5")
+	c.Dir = dir
+
+	if _, err := FromCmd(c); err != ErrCmdNotStarted {
+		t.Errorf("expected ErrCmdNotStarted, found %v", err)
+	}
+
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer c.Process.Kill()
+
+	proc, err := FromCmd(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc.Pid != c.Process.Pid {
+		t.Errorf("proc pid incorrect, expected %d, found %d", c.Process.Pid, proc.Pid)
+	}
+	if proc.Cmd != "sleep" {
+		t.Errorf("proc cmd incorrect, expected sleep, found %s", proc.Cmd)
+	}
+	if len(proc.Args) != 1 || proc.Args[0] != "5" {
+		t.Errorf("proc args incorrect, expected %q, found %q", []string{"5"}, proc.Args)
+	}
+	if proc.Cwd != dir {
+		t.Errorf("proc cwd incorrect, expected %s, found %s", dir, proc.Cwd)
+	}
+	if proc.Tty != currentTty {
+		t.Errorf("proc tty incorrect, expected %s, found %s", currentTty, proc.Tty)
+	}
+}
+
+func TestFindByPidString(t *testing.T) {
+	proc, err := FindByPidString(fmt.Sprintf(" %d\n", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != pid {
+		t.Errorf("proc pid incorrect, expected %d, found %d", pid, proc.Pid)
+	}
+
+	for _, s := range []string{"-1", "abc", ""} {
+		if _, err := FindByPidString(s); err != ErrInvalidNumber {
+			t.Errorf("FindByPidString(%q) expected ErrInvalidNumber, found %v", s, err)
+		}
+	}
+}
+
+func TestSelf(t *testing.T) {
+	proc, err := Self()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc.Pid != pid {
+		t.Errorf("proc pid incorrect, expected %d, found %d", pid, proc.Pid)
+	}
+
+	if proc.Tty != currentTty {
+		t.Errorf("proc tty incorrect, expected %s, found %s", currentTty, proc.Tty)
+	}
+
+	if proc.Cwd != cwd {
+		t.Errorf("proc cwd incorrect, expected %s, found %s", cwd, proc.Cwd)
+	}
+
+	if strings.Join(proc.Args, " ") != strings.Join(args, " ") {
+		t.Errorf("proc args incorrect, expected %q, found %q", args, proc.Args)
+	}
+}
+
+func TestFindByPidFast(t *testing.T) {
+	// Record the commands that each lookup runs.
+	var commands []string
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		commands = append(commands, name)
+		return exec.Command(name, arg...)
+	}
+	defer func() { execCommand = exec.Command }()
+
+	full, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullCommands := commands
+
+	commands = nil
+	fast, err := FindByPidFast(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastCommands := commands
+
+	// FindByPidFast must skip the cwd lookup that FindByPid does. Off linux
+	// that's the slow lsof call, so it must run fewer commands, whereas on
+	// linux the cwd is read from /proc without running any command, so the
+	// cwd being left empty shows that the lookup was skipped.
+	for _, name := range fastCommands {
+		if name == "lsof" {
+			t.Errorf("expected FindByPidFast not to run lsof, ran %v", fastCommands)
+		}
+	}
+	if runtime.GOOS == "linux" && len(fastCommands) != len(fullCommands) {
+		t.Errorf("expected FindByPidFast to run the same commands as FindByPid on linux, ran %v vs %v",
+			fastCommands, fullCommands)
+	}
+	if runtime.GOOS != "linux" && len(fastCommands) >= len(fullCommands) {
+		t.Errorf("expected FindByPidFast to run fewer commands than FindByPid, ran %v vs %v",
+			fastCommands, fullCommands)
+	}
+
+	if full.Cwd == "" {
+		t.Error("expected full proc cwd to be set")
+	}
+	if fast.Cwd != "" {
+		t.Errorf("expected proc cwd to be empty, found %s", fast.Cwd)
+	}
+
+	if fast.Pid != full.Pid || fast.UID != full.UID || fast.Tty != full.Tty ||
+		fast.Cmd != full.Cmd || fast.FullCommand() != full.FullCommand() {
+		t.Errorf("fast proc incorrect, expected\n%s\nfound\n%s", full, fast)
+	}
+}
+
+func TestWaitAnyNonChild(t *testing.T) {
+	// Start a sleep in the background of a shell, so once the shell exits the
+	// sleep is no longer a child of the current process.
+	out, err := exec.Command("sh", "-c", "sleep 1 & echo $!").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sleepPid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := FindByPidFast(sleepPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := proc.WaitAny(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitAnyChild(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "exit 2"}}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+
+	err := proc.WaitAny(context.Background())
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an *exec.ExitError, found %v", err)
+	}
+
+	if exitErr.ExitCode() != 2 {
+		t.Errorf("proc exit code incorrect, expected 2, found %d", exitErr.ExitCode())
+	}
+}
+
+func TestStartNotifyAfterProcessSet(t *testing.T) {
+	proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	if err := proc.HealthCheck(); err != nil {
+		t.Errorf("expected started process to be running, found %v", err)
+	}
+}
+
+func TestIsSessionLeader(t *testing.T) {
+	// A process that isn't in a tty is started in a new session when it's
+	// detached.
+	detached := &Process{Cmd: "sleep", Args: []string{"5"}, Tty: "??"}
+	attached := &Process{Cmd: "sleep", Args: []string{"5"}, Tty: "??"}
+
+	for _, proc := range []*Process{detached, attached} {
+		notify := make(chan struct{})
+		go proc.Start(proc == detached, nil, nil, nil, notify)
+		<-notify
+		defer proc.Kill()
+	}
+
+	if leader, err := detached.IsSessionLeader(); err != nil || !leader {
+		t.Errorf("expected detached proc to be a session leader, found %v, %v", leader, err)
+	}
+	if leader, err := attached.IsSessionLeader(); err != nil || leader {
+		t.Errorf("expected attached proc not to be a session leader, found %v, %v", leader, err)
+	}
+}
+
+func TestDetachAttached(t *testing.T) {
+	proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	if err := proc.Detach(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, found %v", err)
+	}
+}
+
+func TestSignalAll(t *testing.T) {
+	var procs []*Process
+	for i := 0; i < 3; i++ {
+		proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+		notify := make(chan struct{})
+		go proc.Start(false, nil, nil, nil, notify)
+		<-notify
+		defer proc.Kill()
+		procs = append(procs, proc)
+	}
+
+	if err := SignalAll(procs, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, proc := range procs {
+		select {
+		case <-proc.Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("expected proc %d to be terminated", proc.Pid)
+		}
+	}
+}
+
+func TestHealthCheckCmd(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: pid}}
+
+	if err := proc.HealthCheckCmd("true"); err != nil {
+		t.Errorf("expected health check with true to pass, found %v", err)
+	}
+
+	if err := proc.HealthCheckCmd("false"); !errors.Is(err, ErrHealthCheckFailed) {
+		t.Errorf("expected ErrHealthCheckFailed, found %v", err)
+	}
+}
+
+func TestStartCombined(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "echo stdout; echo stderr >&2; echo stdout"}}
+
+	var combined bytes.Buffer
+	if err := proc.StartCombined(false, nil, &combined, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if combined.String() != "stdout\nstderr\nstdout\n" {
+		t.Errorf("combined output incorrect, expected %q, found %q",
+			"stdout\nstderr\nstdout\n", combined.String())
+	}
+}
+
+func TestStartWith(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", `read line; echo "$line $FOO $(pwd)"; echo err >&2`}}
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	notify := make(chan struct{}, 1)
+	err = proc.StartWith(StartConfig{
+		Stdin:  strings.NewReader("hello\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Env:    []string{"FOO=bar"},
+		Dir:    dir,
+		Notify: notify,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "hello bar " + dir + "\n"; stdout.String() != expected {
+		t.Errorf("stdout incorrect, expected %q, found %q", expected, stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("stderr incorrect, expected %q, found %q", "err\n", stderr.String())
+	}
+	select {
+	case <-notify:
+	default:
+		t.Error("expected notify to be sent to")
+	}
+}
+
+func TestStartExtraFiles(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The read end of the pipe is the child's fd 3.
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "cat <&3"}, ExtraFiles: []*os.File{r}}
+
+	if _, err := w.WriteString("handed off\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	var stdout bytes.Buffer
+	if err := proc.Start(false, nil, &stdout, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "handed off\n" {
+		t.Errorf("stdout incorrect, expected %q, found %q", "handed off\n", stdout.String())
+	}
+}
+
+func TestRestartWith(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "echo started; exec sleep 5"}}
+
+	var buf bytes.Buffer
+	out := &lockedWriter{w: &buf}
+	output := func() string {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return buf.String()
+	}
+	waitOutput := func(expected string) {
+		for i := 0; i < 50 && output() != expected; i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if output() != expected {
+			t.Fatalf("output incorrect, expected %q, found %q", expected, output())
+		}
+	}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, out, nil, notify)
+	<-notify
+	waitOutput("started\n")
+	first := proc.Pid
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- proc.RestartWith(StartConfig{Stdout: out, Notify: notify})
+	}()
+	<-notify
+	defer proc.Kill()
+
+	if proc.Pid == first {
+		t.Errorf("expected restarted process to have a new pid, found %d", first)
+	}
+
+	// Both incarnations should have written to the same buffer.
+	waitOutput("started\nstarted\n")
+
+	proc.Kill()
+	if err := <-errc; err == nil {
+		t.Error("expected killed process to exit unsuccessfully")
+	}
+}
+
+func TestReload(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c",
+		"trap 'echo reloaded' HUP; echo ready; while :; do sleep 0.1; done"}}
+
+	var buf bytes.Buffer
+	out := &lockedWriter{w: &buf}
+	reloads := func() int {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return strings.Count(buf.String(), "reloaded")
+	}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, out, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	// Wait for the trap to be set before sending a SIGHUP.
+	for i := 0; i < 50; i++ {
+		out.mu.Lock()
+		ready := strings.Contains(buf.String(), "ready")
+		out.mu.Unlock()
+		if ready {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := proc.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && reloads() < 1; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if reloads() != 1 {
+		t.Fatalf("expected the process to log 1 reload, found %d", reloads())
+	}
+
+	err := proc.ReloadAndWait(func() error {
+		if reloads() < 2 {
+			return errors.New("not reloaded yet")
+		}
+		return nil
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = proc.ReloadAndWait(func() error {
+		return errors.New("never ready")
+	}, 200*time.Millisecond)
+	if !errors.Is(err, ErrReloadTimeout) {
+		t.Errorf("expected ErrReloadTimeout, found %v", err)
+	}
+}
+
+func TestKillAndWait(t *testing.T) {
+	proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+
+	if err := proc.KillAndWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.HealthCheck(); err == nil {
+		t.Error("expected killed process to fail it's health check")
+	}
+}
+
+func TestSignalTree(t *testing.T) {
+	// Start a shell that starts another shell that starts a sleep, with the
+	// sleep's pid written to stdout.
+	c := exec.Command("sh", "-c", `sh -c 'sleep 5 & echo $!; wait' & wait`)
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Process.Kill()
+
+	var sleepPid int
+	if _, err := fmt.Fscan(stdout, &sleepPid); err != nil {
+		t.Fatal(err)
+	}
+	sleep, err := FindByPidFields(sleepPid, "ppid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell, err := FindByPidFields(sleep.PPid, "ppid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shell.PPid != c.Process.Pid {
+		t.Fatalf("expected shell %d to be a child of %d, found %d", shell.Pid, c.Process.Pid, shell.PPid)
+	}
+
+	proc := &Process{Process: c.Process}
+	if err := proc.SignalTree(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	c.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, descendant := range []*Process{shell, sleep} {
+		if err := descendant.waitGone(ctx); err != nil {
+			t.Errorf("expected process %d to be signalled, found %v", descendant.Pid, err)
+		}
+	}
+}
+
+func TestWaitAnyFirst(t *testing.T) {
+	var procs []*Process
+	for _, d := range []string{"5", "1"} {
+		proc := &Process{Cmd: "sleep", Args: []string{d}}
+		notify := make(chan struct{})
+		go proc.Start(false, nil, nil, nil, notify)
+		<-notify
+		defer proc.Kill()
+		procs = append(procs, proc)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	first, err := WaitAny(ctx, procs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != procs[1] {
+		t.Errorf("expected the 1 second sleep %d to exit first, found %d", procs[1].Pid, first.Pid)
+	}
+}
+
+func TestReap(t *testing.T) {
+	c := exec.Command("true")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Process{Process: c.Process}
+	state, err := proc.Reap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Success() {
+		t.Errorf("expected proc to exit successfully, found %s", state)
+	}
+
+	if _, err := proc.Reap(); !errors.Is(err, ErrProcReaped) {
+		t.Errorf("expected ErrProcReaped, found %v", err)
+	}
+}
+
+func TestReapRestarted(t *testing.T) {
+	proc := &Process{Cmd: "true"}
+	if err := proc.Start(false, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.Reap(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restarted process is a new child, so it can be reaped again.
+	firstPid := proc.Pid
+	if err := proc.RestartWith(StartConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid == firstPid {
+		t.Fatalf("expected proc to be restarted with a new pid, found %d", proc.Pid)
+	}
+	state, err := proc.Reap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Success() {
+		t.Errorf("expected proc to exit successfully, found %s", state)
+	}
+}
+
+func TestReapNonChild(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: os.Getppid()}}
+	if _, err := proc.Reap(); !errors.Is(err, ErrProcNotChild) {
+		t.Errorf("expected ErrProcNotChild, found %v", err)
+	}
+}
+
+func TestProtectCriticalPids(t *testing.T) {
+	for _, pid := range []int{1, os.Getpid(), os.Getppid()} {
+		proc := &Process{Process: &os.Process{Pid: pid}}
+		if err := proc.Kill(); !errors.Is(err, ErrProtectedPid) {
+			t.Errorf("Kill for pid %d expected ErrProtectedPid, found %v", pid, err)
+		}
+		if err := proc.Signal(syscall.SIGTERM); !errors.Is(err, ErrProtectedPid) {
+			t.Errorf("Signal for pid %d expected ErrProtectedPid, found %v", pid, err)
+		}
+		if err := proc.SignalTree(syscall.SIGTERM); !errors.Is(err, ErrProtectedPid) {
+			t.Errorf("SignalTree for pid %d expected ErrProtectedPid, found %v", pid, err)
+		}
+	}
+
+	// Signal 0 only checks that the process exists.
+	self := &Process{Process: &os.Process{Pid: os.Getpid()}}
+	if err := self.Signal(syscall.Signal(0)); err != nil {
+		t.Errorf("expected signal 0 to be allowed, found %v", err)
+	}
+}
+
+func TestNumFDs(t *testing.T) {
+	proc := &Process{Process: &os.Process{Pid: pid}}
+
+	before, err := proc.NumFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before < 3 {
+		t.Errorf("expected at least 3 fds, found %d", before)
+	}
+
+	f, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	after, err := proc.NumFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before {
+		t.Errorf("expected fds to increase from %d after opening a file, found %d", before, after)
+	}
+}
+
+func TestScriptPath(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(script, []byte("sleep 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args   []string
+		script string
+	}{
+		{[]string{"-u", script, "--flag"}, script},
+		{[]string{"-c", "sleep 5", script}, ""},
+	}
+
+	for _, test := range tests {
+		proc := &Process{Cmd: "sh", Args: test.args}
+
+		notify := make(chan struct{})
+		go proc.Start(false, nil, nil, nil, notify)
+		<-notify
+
+		path, err := proc.ScriptPath()
+		proc.Kill()
+
+		if test.script == "" {
+			if !errors.Is(err, ErrNoScript) {
+				t.Errorf("ScriptPath for %v expected ErrNoScript, found %v", test.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ScriptPath for %v error: %v", test.args, err)
+			continue
+		}
+		if path != test.script {
+			t.Errorf("ScriptPath for %v incorrect, expected %s, found %s", test.args, test.script, path)
+		}
+	}
+}
+
+func TestRunWithInput(t *testing.T) {
+	proc := &Process{Cmd: "cat"}
+
+	stdout, stderr, err := proc.RunWithInput("hello\nworld\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != "hello\nworld\n" {
+		t.Errorf("stdout incorrect, expected %q, found %q", "hello\nworld\n", stdout)
+	}
+	if stderr != "" {
+		t.Errorf("expected stderr to be empty, found %q", stderr)
+	}
+
+	// Grep stdin and a missing file, so that grep writes the matching line to
+	// stdout and an error about the missing file to stderr.
+	proc = &Process{Cmd: "grep", Args: []string{"world", "-", "/does/not/exist"}}
+
+	stdout, stderr, err = proc.RunWithInput("hello\nworld\n")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an *exec.ExitError, found %v", err)
+	}
+	if stdout != "(standard input):world\n" {
+		t.Errorf("stdout incorrect, expected %q, found %q",
+			"(standard input):world\n", stdout)
+	}
+	if !strings.Contains(stderr, "/does/not/exist") {
+		t.Errorf("expected stderr to mention the missing file, found %q", stderr)
+	}
+}
+
+// stubPsE replaces execCommand so that running ps -e prints output instead of
+// the real process table. It returns a func that restores execCommand.
+func stubPsE(output string) func() {
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		if name == "ps" && len(arg) > 0 && arg[0] == "-e" {
+			return exec.Command("printf", "%s", output)
+		}
+		return exec.Command(name, arg...)
+	}
+	return func() { execCommand = exec.Command }
+}
+
+func TestToolCommandLocale(t *testing.T) {
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", "echo $LC_ALL")
+	}
+	out, err := runOutput("ps")
+	execCommand = exec.Command
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locale := strings.TrimSpace(string(out)); locale != "C" {
+		t.Errorf("ps locale incorrect, expected C, found %s", locale)
+	}
+
+	// Parsing real ps output should still work.
+	proc, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.StartTime.IsZero() {
+		t.Error("expected proc start time to be parsed")
+	}
+}
+
+func TestPsHeaderSkipped(t *testing.T) {
+	// The command CMD is also found in ps's header line.
+	defer stubPsE("  PID TTY          TIME CMD\n" +
+		" 4242 pts/0    00:00:00 CMD\n")()
+
+	proc := &Process{Cmd: "CMD"}
+	if err := proc.FindProcess(); err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != 4242 {
+		t.Errorf("proc pid is incorrect, expected 4242, found %d", proc.Pid)
+	}
+}
+
+func TestStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listings := Stream(ctx, 50*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		procs, ok := <-listings
+		if !ok {
+			t.Fatalf("expected listing %d before the stream was closed", i)
+		}
+		found := false
+		for _, proc := range procs {
+			if proc.Pid == pid {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected listing %d to contain pid %d", i, pid)
+		}
+	}
+
+	cancel()
+	for range listings {
+	}
+}
+
+func TestListAllPsHeaderSkipped(t *testing.T) {
+	defer stubPsE("  PID  PPID   UID TT       COMMAND\n" +
+		" 4242     1     0 pts/0    CMD\n")()
+
+	procs, err := ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 1 || procs[0].Pid != 4242 {
+		t.Errorf("expected only process 4242 to be listed, found %v", procs)
+	}
+}
+
+func TestFindByNamePsHeaderSkipped(t *testing.T) {
+	// The name tty is also found in ps's header line.
+	defer stubPsE(fmt.Sprintf("  PID TTY          TIME CMD\n"+
+		" %d pts/0    00:00:00 proctty\n", pid))()
+
+	var stdout bytes.Buffer
+	proc, err := FindByName(&stdout, strings.NewReader("0\n"), "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != pid {
+		t.Errorf("proc pid is incorrect, expected %d, found %d", pid, proc.Pid)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	defer stubPsE("  PID TTY          TIME CMD\n" +
+		" 4242 pts/0    00:00:00 twice\n" +
+		" 4243 pts/1    00:00:00 other\n" +
+		" 4244 pts/2    00:00:00 twice\n")()
+
+	proc := &Process{Cmd: "twice"}
+	procs, err := proc.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(procs) != 2 {
+		t.Fatalf("expected 2 processes, found %d", len(procs))
+	}
+	if procs[0].Pid != 4242 || procs[0].Tty != "pts/0" {
+		t.Errorf("first proc incorrect, expected 4242 pts/0, found %d %s", procs[0].Pid, procs[0].Tty)
+	}
+	if procs[1].Pid != 4244 || procs[1].Tty != "pts/2" {
+		t.Errorf("second proc incorrect, expected 4244 pts/2, found %d %s", procs[1].Pid, procs[1].Tty)
+	}
+
+	if proc.Process != nil || proc.Tty != "" {
+		t.Errorf("expected proc to be unchanged, found %+v", proc)
+	}
+}
+
+func TestSelectByName(t *testing.T) {
+	defer stubPsE(fmt.Sprintf("  PID TTY          TIME CMD\n"+
+		" %d pts/0    00:00:00 selectme\n"+
+		" 4242 pts/0    00:00:00 other\n"+
+		" 4243 pts/0    00:00:00 selectme\n", pid))()
+
+	proc, err := SelectByName("selectme", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != pid {
+		t.Errorf("proc pid is incorrect, expected %d, found %d", pid, proc.Pid)
+	}
+
+	if _, err := SelectByName("selectme", 2); err != ErrInvalidNumber {
+		t.Errorf("expected ErrInvalidNumber, found %v", err)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	defer stubPsE("  PID TTY          TIME CMD\n" +
+		" 4242 pts/0    00:00:00 Candidate\n" +
+		" 4243 pts/0    00:00:00 other\n" +
+		" 4244 ?        00:00:00 candidate --flag\n")()
+
+	candidates, err := Candidates("candidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, found %d", len(candidates))
+	}
+	if candidates[0].Pid != 4242 || candidates[0].Cmd != "Candidate" {
+		t.Errorf("first candidate incorrect, expected 4242 %q, found %d %q",
+			"Candidate", candidates[0].Pid, candidates[0].Cmd)
+	}
+	if candidates[1].Pid != 4244 || candidates[1].Cmd != "candidate --flag" {
+		t.Errorf("second candidate incorrect, expected 4244 %q, found %d %q",
+			"candidate --flag", candidates[1].Pid, candidates[1].Cmd)
+	}
+}
+
+func TestCandidatesPsHeaderSkipped(t *testing.T) {
+	// Both the leading and the repeated header lines contain "tty", and the
+	// repeated one mustn't be joined to the previous process's command.
+	defer stubPsE("  PID TTY          TIME CMD\n" +
+		" 4242 pts/0    00:00:00 getty\n" +
+		"  PID TTY          TIME CMD\n" +
+		" 4243 pts/1    00:00:00 agetty\n")()
+
+	candidates, err := Candidates("tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, found %d", len(candidates))
+	}
+	for i, cmd := range []string{"getty", "agetty"} {
+		if candidates[i].Cmd != cmd {
+			t.Errorf("candidate %d incorrect, expected %q, found %q", i, cmd, candidates[i].Cmd)
+		}
+	}
+}
+
+func TestFindProcessRetry(t *testing.T) {
+	// Only show the process in ps on the third call.
+	calls := 0
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		calls++
+		output := "  PID TTY          TIME CMD\n"
+		if calls == 3 {
+			output += " 4242 pts/0    00:00:00 retried\n"
+		}
+		return exec.Command("printf", "%s", output)
+	}
+	defer func() { execCommand = exec.Command }()
+
+	proc := &Process{Cmd: "retried"}
+
+	if err := proc.FindProcessRetry(2, time.Millisecond); !errors.Is(err, ErrProcNotFound) {
+		t.Fatalf("expected ErrProcNotFound, found %v", err)
+	}
+
+	calls = 0
+	if err := proc.FindProcessRetry(3, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != 4242 {
+		t.Errorf("proc pid is incorrect, expected 4242, found %d", proc.Pid)
+	}
+}
+
+func TestPgidSid(t *testing.T) {
+	proc, err := FindByPidFast(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pgid, err := proc.Pgid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pgid == 0 || pgid != syscall.Getpgrp() {
+		t.Errorf("proc pgid incorrect, expected %d, found %d", syscall.Getpgrp(), pgid)
+	}
+
+	sid, err := proc.Sid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSid, err := getsid(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid == 0 || sid != expectedSid {
+		t.Errorf("proc sid incorrect, expected %d, found %d", expectedSid, sid)
+	}
+}
+
+func TestStartCredential(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("starting as another user requires root privileges")
+	}
+
+	proc := &Process{
+		Cmd:        "id",
+		Args:       []string{"-u"},
+		Credential: &syscall.Credential{Uid: 65534, Gid: 65534},
+	}
+
+	var stdout bytes.Buffer
+	if err := proc.Start(false, nil, &stdout, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if uid := strings.TrimSpace(stdout.String()); uid != "65534" {
+		t.Errorf("proc uid incorrect, expected 65534, found %s", uid)
+	}
+}
+
+func TestClose(t *testing.T) {
+	proc := &Process{Cmd: "cat"}
+
+	stdin, _, _, err := proc.StartPipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the process again should do nothing.
+	if err := proc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stdin.Write([]byte("hello\n")); err == nil {
+		t.Error("expected write to closed stdin to fail")
+	}
+
+	// Done shouldn't send a state for a closed process.
+	if state := <-proc.Done(); state != nil {
+		t.Errorf("expected no state from a closed process, found %v", state)
+	}
+}
+
+func TestCloseRestart(t *testing.T) {
+	proc := &Process{Cmd: "true"}
+	if err := proc.Start(false, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Starting the process again should open it again, so Done sends the
+	// new process's state.
+	if err := proc.Start(false, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	state := <-proc.Done()
+	if state == nil {
+		t.Fatal("expected a state from the restarted process, found nil")
+	}
+	if !state.Success() {
+		t.Errorf("expected proc to exit successfully, found %s", state)
+	}
+}
+
+func TestStdoutReader(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "for i in 1 2 3; do echo line $i; sleep 0.1; done"}}
+
+	if _, err := proc.StdoutReader(); err != ErrProcNoPipes {
+		t.Errorf("expected ErrProcNoPipes, found %v", err)
+	}
+
+	if _, _, _, err := proc.StartPipes(false); err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	stdout, err := proc.StdoutReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each line should be read as it's printed, before the process exits.
+	scanner := bufio.NewScanner(stdout)
+	for i := 1; i <= 3; i++ {
+		if !scanner.Scan() {
+			t.Fatalf("expected line %d, found %v", i, scanner.Err())
+		}
+		if expected := fmt.Sprintf("line %d", i); scanner.Text() != expected {
+			t.Errorf("line %d incorrect, expected %q, found %q", i, expected, scanner.Text())
+		}
+		if i < 3 && proc.Exited() {
+			t.Errorf("expected process to still be running after line %d", i)
+		}
+	}
+}
+
+func TestExited(t *testing.T) {
+	proc := &Process{Cmd: "cat"}
+
+	stdin, _, _, err := proc.StartPipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	if proc.Exited() {
+		t.Error("expected running process to not have exited")
+	}
+
+	// Closing cat's stdin causes it to exit.
+	stdin.Close()
+	<-proc.Done()
+
+	if !proc.Exited() {
+		t.Error("expected finished process to have exited")
+	}
+}
+
+func TestFindByPidCwdWithSpaces(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.Join(dir, "a  b\tc ")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sleepCmd := exec.Command("sleep", "5")
+	sleepCmd.Dir = dir
+	if err := sleepCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sleepCmd.Process.Kill()
+
+	proc, err := FindByPid(sleepCmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc.Cwd != dir {
+		t.Errorf("proc cwd incorrect, expected %q, found %q", dir, proc.Cwd)
+	}
+}
+
+func TestLogf(t *testing.T) {
+	var logs []string
+	Logf = func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	defer func() { Logf = nil }()
+
+	if _, err := FindByPid(pid); err != nil {
+		t.Fatal(err)
+	}
+
+	var execs, parses int
+	for _, log := range logs {
+		if strings.HasPrefix(log, "exec ps -o ") {
+			execs++
+		}
+		if strings.HasPrefix(log, "parse ps fields ") {
+			parses++
+		}
+	}
+	if execs == 0 || parses == 0 {
+		t.Errorf("expected ps exec and parse logs, found %q", logs)
+	}
+}
+
+func TestFindByOpenFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "open"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	procs, err := FindByOpenFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, proc := range procs {
+		found = found || proc.Pid == pid
+	}
+	if !found {
+		t.Errorf("expected to find current process with pid %d, found %v", pid, procs)
+	}
+}
+
+func TestFindByPort(t *testing.T) {
+	// Listen using syscall rather than net, since importing net would stop
+	// the test binary from being statically linked, which TestStartChroot
+	// relies on.
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 1); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	procs, err := FindByPort("tcp", addr.(*syscall.SockaddrInet4).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, proc := range procs {
+		found = found || proc.Pid == pid
+	}
+	if !found {
+		t.Errorf("expected to find current process with pid %d, found %v", pid, procs)
+	}
+}
+
+func TestArgParser(t *testing.T) {
+	var command, comm string
+	ArgParser = func(c, cm string) []string {
+		command, comm = c, cm
+		return []string{"parsed"}
+	}
+	defer func() { ArgParser = defaultArgParser }()
+
+	proc, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proc.Args) != 1 || proc.Args[0] != "parsed" {
+		t.Errorf("proc args incorrect, expected %q, found %q", []string{"parsed"}, proc.Args)
+	}
+	if comm != proc.Cmd || !strings.Contains(command, comm) {
+		t.Errorf("expected ArgParser to be called with comm %q, found command %q and comm %q",
+			proc.Cmd, command, comm)
+	}
+}
+
+func TestArgParserWrapped(t *testing.T) {
+	// Wrap the built-in parser rather than replacing it.
+	parse := ArgParser
+	ArgParser = func(command, comm string) []string {
+		return append(parse(command, comm), "wrapped")
+	}
+	defer func() { ArgParser = defaultArgParser }()
+
+	proc, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proc.Args) == 0 || proc.Args[len(proc.Args)-1] != "wrapped" {
+		t.Errorf("expected proc args to end with the wrapped arg, found %q", proc.Args)
+	}
+}
+
+func TestCwdExists(t *testing.T) {
+	proc := &Process{Cwd: t.TempDir()}
+	if !proc.CwdExists() {
+		t.Errorf("expected cwd %s to exist", proc.Cwd)
+	}
+
+	// Simulate the cwd of a process in another mount namespace.
+	proc.Cwd = filepath.Join(proc.Cwd, "not", "on", "host")
+	if proc.CwdExists() {
+		t.Errorf("expected cwd %s not to exist", proc.Cwd)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	proc1, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc2, err := FindByPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc1.StartTime.IsZero() {
+		t.Error("expected proc start time to be set")
+	}
+
+	if proc1.Identity() != proc2.Identity() {
+		t.Errorf("expected identities of the same process to be equal, found %s and %s",
+			proc1.Identity(), proc2.Identity())
+	}
+
+	sleepCmd := exec.Command("sleep", "5")
+	if err := sleepCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sleepCmd.Process.Kill()
+
+	other, err := FindByPid(sleepCmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc1.Identity() == other.Identity() {
+		t.Error("expected identities of different processes to differ")
+	}
+}
+
+func TestFindByPidFields(t *testing.T) {
+	proc, err := FindByPidFields(pid, "ppid", "state", "rss", "%cpu", "lstart")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc.PPid != os.Getppid() {
+		t.Errorf("proc ppid incorrect, expected %d, found %d", os.Getppid(), proc.PPid)
+	}
+
+	if proc.RunState != StateRunning && proc.RunState != StateSleeping {
+		t.Errorf("expected proc state to be running or sleeping, found %s", proc.RunState)
+	}
+
+	if proc.RSS == 0 {
+		t.Error("expected proc rss to be non-zero")
+	}
+
+	if proc.StartTime.IsZero() || proc.StartTime.After(time.Now()) {
+		t.Errorf("proc start time incorrect, found %s", proc.StartTime)
+	}
+
+	// Fields that weren't requested shouldn't be populated.
+	if proc.Cmd != "" || proc.Tty != "" || proc.Args != nil {
+		t.Errorf("expected unrequested fields to be empty, found\n%s", proc)
+	}
+
+	if _, err := FindByPidFields(pid, "nope"); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestListAllContextCancel(t *testing.T) {
+	// Output one process and then hang as if ps were stuck.
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", "echo ' 4242     1     0 pts/0    slow'; exec sleep 5")
+	}
+	defer func() { execCommand = exec.Command }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	procs, err := ListAllContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, found %v", err)
+	}
+	if procs != nil {
+		t.Errorf("expected no processes, found %v", procs)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected ListAllContext to return promptly, took %s", elapsed)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	procs, err := Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var self *Process
+	for _, proc := range procs {
+		if proc.Pid == pid {
+			self = proc
+		}
+	}
+	if self == nil {
+		t.Fatalf("expected to find current process with pid %d", pid)
+	}
+	if self.RSS == 0 {
+		t.Error("expected proc rss to be non-zero")
+	}
+	if self.RunState != StateRunning && self.RunState != StateSleeping {
+		t.Errorf("expected proc state to be running or sleeping, found %s", self.RunState)
+	}
+}
+
+func TestListAllCommandWithNewline(t *testing.T) {
+	defer stubPsE(" 4242     1     0 pts/0    two\nlines\n" +
+		" 4243     1     0 pts/0    one line\n")()
+
+	procs, err := ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(procs) != 2 {
+		t.Fatalf("expected 2 processes, found %d", len(procs))
+	}
+	if procs[0].Pid != 4242 || procs[0].Cmd != "two\nlines" {
+		t.Errorf("first proc incorrect, expected 4242 %q, found %d %q",
+			"two\nlines", procs[0].Pid, procs[0].Cmd)
+	}
+	if procs[1].Pid != 4243 || procs[1].Cmd != "one line" {
+		t.Errorf("second proc incorrect, expected 4243 %q, found %d %q",
+			"one line", procs[1].Pid, procs[1].Cmd)
+	}
+}
+
+func TestFindProcessCommandWithNewline(t *testing.T) {
+	defer stubPsE("  PID TTY          TIME CMD\n" +
+		" 4242 pts/0    00:00:00 two\nlines\n" +
+		" 4243 pts/0    00:00:00 other\n")()
+
+	proc := &Process{Cmd: "two\nlines"}
+	if err := proc.FindProcess(); err != nil {
+		t.Fatal(err)
+	}
+	if proc.Pid != 4242 {
+		t.Errorf("proc pid is incorrect, expected 4242, found %d", proc.Pid)
+	}
+}
@@ -0,0 +1,41 @@
+package process
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestSignalName(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  syscall.Signal
+	}{
+		{"SIGTERM", syscall.SIGTERM},
+		{"SIGKILL", syscall.SIGKILL},
+		{"SIGHUP", syscall.SIGHUP},
+		{"SIGUSR1", syscall.SIGUSR1},
+	}
+
+	for _, test := range tests {
+		if name := SignalName(test.sig); name != test.name {
+			t.Errorf("SignalName(%d) incorrect, expected %s, found %s", test.sig, test.name, name)
+		}
+
+		sig, ok := SignalFromName(SignalName(test.sig))
+		if !ok || sig != test.sig {
+			t.Errorf("SignalFromName(%q) incorrect, expected %v, found %v", test.name, test.sig, sig)
+		}
+	}
+}
+
+func TestSignalFromName(t *testing.T) {
+	for _, name := range []string{"TERM", "sigterm", "term"} {
+		if sig, ok := SignalFromName(name); !ok || sig != syscall.SIGTERM {
+			t.Errorf("SignalFromName(%q) incorrect, expected %v, found %v", name, syscall.SIGTERM, sig)
+		}
+	}
+
+	if _, ok := SignalFromName("NOTASIGNAL"); ok {
+		t.Error("expected SignalFromName to fail for an unknown signal")
+	}
+}
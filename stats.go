@@ -0,0 +1,325 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBudgetExceeded is an error that occurs when a process is killed by
+// EnforceCPUBudget for using more cpu time than it's budget.
+var ErrBudgetExceeded = fmt.Errorf("error: process exceeded it's cpu time budget")
+
+// State describes the run state of a process, as given by the first letter
+// of the state reported by ps.
+type State byte
+
+const (
+	StateRunning   State = 'R'
+	StateSleeping  State = 'S'
+	StateDiskSleep State = 'D'
+	StateStopped   State = 'T'
+	StateZombie    State = 'Z'
+	StateIdle      State = 'I'
+)
+
+// String returns a readable name for the state.
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateSleeping:
+		return "sleeping"
+	case StateDiskSleep:
+		return "disk sleep"
+	case StateStopped:
+		return "stopped"
+	case StateZombie:
+		return "zombie"
+	case StateIdle:
+		return "idle"
+	}
+	return string(s)
+}
+
+// Stats describes the resource usage and state of a process.
+type Stats struct {
+	// RSS is the resident set size of the process in bytes.
+	RSS uint64
+
+	// CPUPercent is the percentage of cpu time the process has used since
+	// it started, as reported by ps's %cpu.
+	CPUPercent float64
+
+	// CPUTime is the total user and system cpu time used by the process.
+	CPUTime time.Duration
+
+	// Threads is the number of threads in the process. Threads is only
+	// set on linux.
+	Threads int
+
+	State State
+}
+
+// State returns the run state of the process, read from /proc/<pid>/stat on
+// linux or from ps elsewhere.
+func (p *Process) State() (State, error) {
+	state, err := readState(p.Pid)
+	if err != nil {
+		return 0, &ProcError{Op: "state", Pid: p.Pid, Err: err}
+	}
+	return state, nil
+}
+
+// Stats returns the process's resource usage and state, gathered all at
+// once from a single read of /proc/<pid>/stat on linux or a single call to
+// ps elsewhere.
+func (p *Process) Stats() (*Stats, error) {
+	stats, err := readStats(p.Pid)
+	if err != nil {
+		return nil, &ProcError{Op: "stats", Pid: p.Pid, Err: err}
+	}
+	return stats, nil
+}
+
+// SampleCPU returns the percentage of cpu time that the process uses over
+// interval, measured from it's cpu time at the start and end of interval,
+// unlike Stats' CPUPercent, which is averaged over the process's lifetime.
+//
+// If the process exits before interval has elapsed, ErrProcNotRunning is
+// returned.
+func (p *Process) SampleCPU(interval time.Duration) (float64, error) {
+	before, err := readStats(p.Pid)
+	if err != nil {
+		return 0, &ProcError{Op: "samplecpu", Pid: p.Pid, Err: err}
+	}
+
+	time.Sleep(interval)
+
+	after, err := readStats(p.Pid)
+	if err != nil || after.State == StateZombie {
+		return 0, &ProcError{Op: "samplecpu", Pid: p.Pid, Err: ErrProcNotRunning}
+	}
+
+	return float64(after.CPUTime-before.CPUTime) / float64(interval) * 100, nil
+}
+
+// EnforceCPUBudget checks the process's total cpu time every poll and kills
+// the process with SIGKILL once it has used more than maxCPUSeconds of cpu
+// time, returning ErrBudgetExceeded, such as to stop a runaway job.
+//
+// EnforceCPUBudget returns nil once the process is no longer running or is a
+// zombie, or ctx's error once ctx is done.
+func (p *Process) EnforceCPUBudget(ctx context.Context, maxCPUSeconds float64, poll time.Duration) error {
+	budget := time.Duration(maxCPUSeconds * float64(time.Second))
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		stats, err := readStats(p.Pid)
+		if err != nil || stats.State == StateZombie {
+			return nil
+		}
+		if stats.CPUTime > budget {
+			if err := p.Kill(); err != nil {
+				return err
+			}
+			return &ProcError{Op: "enforcecpubudget", Pid: p.Pid, Err: ErrBudgetExceeded}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForIdle samples the process's cpu usage every poll and returns once it
+// has stayed below belowPercent for at least sustain, such as to wait for a
+// build or a server's startup to settle before carrying on.
+//
+// If the process exits or is a zombie first, ErrProcNotRunning is returned,
+// or if ctx is done first, ctx's error is returned.
+func (p *Process) WaitForIdle(ctx context.Context, belowPercent float64, sustain, poll time.Duration) error {
+	before, err := readStats(p.Pid)
+	if err != nil || before.State == StateZombie {
+		return &ProcError{Op: "waitforidle", Pid: p.Pid, Err: ErrProcNotRunning}
+	}
+	last := time.Now()
+
+	// idleSince is the start of the first sample in the current run of
+	// samples below belowPercent, or zero if the last sample wasn't.
+	var idleSince time.Time
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		after, err := readStats(p.Pid)
+		if err != nil || after.State == StateZombie {
+			return &ProcError{Op: "waitforidle", Pid: p.Pid, Err: ErrProcNotRunning}
+		}
+		now := time.Now()
+		percent := float64(after.CPUTime-before.CPUTime) / float64(now.Sub(last)) * 100
+
+		if percent >= belowPercent {
+			idleSince = time.Time{}
+		} else if idleSince.IsZero() {
+			idleSince = last
+		}
+		if !idleSince.IsZero() && now.Sub(idleSince) >= sustain {
+			return nil
+		}
+		before, last = after, now
+	}
+}
+
+// IOStats returns the number of bytes that the process has caused to be read
+// from and written to storage, as opposed to bytes read from or written to
+// the page cache.
+//
+// IOStats is only supported on linux and returns ErrUnsupported elsewhere.
+func (p *Process) IOStats() (readBytes, writeBytes uint64, err error) {
+	readBytes, writeBytes, err = readIOStats(p.Pid)
+	if err != nil {
+		return 0, 0, &ProcError{Op: "iostats", Pid: p.Pid, Err: err}
+	}
+	return readBytes, writeBytes, nil
+}
+
+// MemoryRSS returns the resident set size of the process in bytes.
+func (p *Process) MemoryRSS() (uint64, error) {
+	stats, err := p.Stats()
+	if err != nil {
+		return 0, err
+	}
+	return stats.RSS, nil
+}
+
+// CPUTime returns the total user and system cpu time that the process has
+// used since it started, which only ever increases, unlike CPUPercent.
+func (p *Process) CPUTime() (time.Duration, error) {
+	stats, err := p.Stats()
+	if err != nil {
+		return 0, err
+	}
+	return stats.CPUTime, nil
+}
+
+// WatchMemory samples the process's resident set size every interval and
+// sends it on the returned channel each time it's over limit, such as to
+// restart a worker that's leaking memory.
+//
+// The channel is closed once the process is no longer running or is a
+// zombie, or once ctx is done. A sample that isn't received is dropped when
+// the next sample is taken, so a slow receiver doesn't stop the watching.
+func (p *Process) WatchMemory(ctx context.Context, limit uint64, interval time.Duration) <-chan uint64 {
+	samples := make(chan uint64, 1)
+	go func() {
+		defer close(samples)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			stats, err := p.Stats()
+			if err != nil || stats.State == StateZombie {
+				return
+			}
+			if stats.RSS > limit {
+				// Replace any sample that hasn't been received yet.
+				select {
+				case <-samples:
+				default:
+				}
+				samples <- stats.RSS
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return samples
+}
+
+// WaitMemoryExceeds samples the process's resident set size every interval
+// and returns once it's over limit bytes, such as for a watchdog to restart
+// a process that's leaking memory, or returns ctx's error once ctx is done.
+//
+// If the process exits or is a zombie first, ErrProcNotRunning is returned.
+func (p *Process) WaitMemoryExceeds(ctx context.Context, limit uint64, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		stats, err := readStats(p.Pid)
+		if err != nil || stats.State == StateZombie {
+			return &ProcError{Op: "waitmemoryexceeds", Pid: p.Pid, Err: ErrProcNotRunning}
+		}
+		if stats.RSS > limit {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ByRSS, ByCPU and ByPid implement sort.Interface to sort processes in
+// ascending order of their RSS, CPUPercent and Pid, such as the processes
+// returned by Snapshot. Use sort.Reverse to sort them in descending order.
+type (
+	ByRSS []*Process
+	ByCPU []*Process
+	ByPid []*Process
+)
+
+func (s ByRSS) Len() int           { return len(s) }
+func (s ByRSS) Less(i, j int) bool { return s[i].RSS < s[j].RSS }
+func (s ByRSS) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s ByCPU) Len() int           { return len(s) }
+func (s ByCPU) Less(i, j int) bool { return s[i].CPUPercent < s[j].CPUPercent }
+func (s ByCPU) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s ByPid) Len() int           { return len(s) }
+func (s ByPid) Less(i, j int) bool { return s[i].Pid < s[j].Pid }
+func (s ByPid) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// parsePsTime parses a cpu time reported by ps's time field, which is in the
+// form [dd-]hh:mm:ss on linux and mm:ss.ss on macOS.
+func parsePsTime(s string) (time.Duration, error) {
+	var days int
+	if i := strings.Index(s, "-"); i >= 0 {
+		var err error
+		days, err = strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, err
+		}
+		s = s[i+1:]
+	}
+
+	var d time.Duration
+	parts := strings.Split(s, ":")
+	for i, part := range parts {
+		unit := time.Second
+		for j := i; j < len(parts)-1; j++ {
+			unit *= 60
+		}
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n * float64(unit))
+	}
+
+	return d + time.Duration(days)*24*time.Hour, nil
+}
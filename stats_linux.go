@@ -0,0 +1,196 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second that times in /proc
+// are measured in, which is USER_HZ and is 100 on practically every system.
+const clockTicks = 100
+
+// readStats reads the stats of the process with the specified pid from
+// /proc/<pid>/stat.
+func readStats(pid int) (*Stats, error) {
+	fields, err := readStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// The fields are numbered as in proc(5), minus 3 since the fields are
+	// read from after the command, starting at the state.
+	field := func(n int) uint64 {
+		v, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return v
+	}
+
+	uptime, err := readUptime()
+	if err != nil {
+		return nil, err
+	}
+
+	cpuTicks := field(14) + field(15)
+	elapsed := uptime - float64(field(22))/clockTicks
+
+	stats := &Stats{
+		RSS:     field(24) * uint64(os.Getpagesize()),
+		CPUTime: time.Duration(cpuTicks) * time.Second / clockTicks,
+		Threads: int(field(20)),
+		State:   State(fields[0][0]),
+	}
+	if elapsed > 0 {
+		stats.CPUPercent = float64(cpuTicks) / clockTicks / elapsed * 100
+	}
+
+	return stats, nil
+}
+
+// readState reads the run state of the process with the specified pid from
+// the first field of /proc/<pid>/stat after it's command.
+func readState(pid int) (State, error) {
+	fields, err := readStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return State(fields[0][0]), nil
+}
+
+// isZombie reports whether the process with the specified pid is a zombie
+// process.
+func isZombie(pid int) bool {
+	state, err := readState(pid)
+	return err == nil && state == StateZombie
+}
+
+// ttyProcessGroups returns the process group id of the process with the
+// specified pid and the foreground process group id of it's controlling tty,
+// which is -1 if the process doesn't have a controlling tty, from fields 5
+// and 8 of /proc/<pid>/stat.
+//
+// The foreground process group can't be read with the TIOCGPGRP ioctl, since
+// that only works for the caller's own controlling tty.
+func ttyProcessGroups(pid int) (pgid, tpgid int, err error) {
+	fields, err := readStat(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	if pgid, err = strconv.Atoi(fields[5-3]); err != nil {
+		return 0, 0, err
+	}
+	if tpgid, err = strconv.Atoi(fields[8-3]); err != nil {
+		return 0, 0, err
+	}
+	return pgid, tpgid, nil
+}
+
+// readIOStats reads the storage read and write bytes of the process with the
+// specified pid from the read_bytes and write_bytes lines of /proc/<pid>/io.
+func readIOStats(pid int) (readBytes, writeBytes uint64, err error) {
+	ioFile, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/io")
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrProcNotRunning
+		}
+		return 0, 0, err
+	}
+
+	for _, line := range strings.Split(string(ioFile), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "read_bytes":
+			readBytes, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		case "write_bytes":
+			writeBytes, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return readBytes, writeBytes, nil
+}
+
+// readStat returns the fields of /proc/<pid>/stat that follow the process's
+// command, which is skipped since it may contain spaces.
+func readStat(pid int) ([]string, error) {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrProcNotRunning
+		}
+		return nil, err
+	}
+
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return nil, fmt.Errorf("error: invalid stat for pid %d", pid)
+	}
+
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("error: invalid stat for pid %d", pid)
+	}
+	return fields, nil
+}
+
+// readUptime returns the number of seconds since the system booted.
+func readUptime() (float64, error) {
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(uptime))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("error: invalid /proc/uptime")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// startTimeFromPs is false since the start time of a process is read
+// precisely from /proc on linux.
+const startTimeFromPs = false
+
+// processStartTime returns the time that the process with the specified pid
+// started, from it's start time in /proc/<pid>/stat, which is measured in
+// clock ticks since the system booted.
+func processStartTime(pid int) (time.Time, error) {
+	fields, err := readStat(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ticks, err := strconv.ParseInt(fields[22-3], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	bootTime, err := readBootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return bootTime.Add(time.Duration(ticks) * time.Second / clockTicks), nil
+}
+
+// readBootTime returns the time that the system booted, from the btime line
+// of /proc/stat.
+func readBootTime() (time.Time, error) {
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(stat), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "btime" {
+			btime, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(btime, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("error: no btime in /proc/stat")
+}
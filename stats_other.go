@@ -0,0 +1,114 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// readStats reads the stats of the process with the specified pid from a
+// single call to ps.
+func readStats(pid int) (*Stats, error) {
+	// ps -o rss=,%cpu=,time=,state= -p $PID
+	out, err := runOutput("ps", "-o", "rss=,%cpu=,time=,state=", strconv.Itoa(pid))
+	if err != nil {
+		return nil, ErrProcNotRunning
+	}
+
+	fields := strings.FieldsFunc(string(out), unicode.IsSpace)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("error: invalid ps stats for pid %d", pid)
+	}
+
+	// rss is reported in kilobytes.
+	rss, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	cpuPercent, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	cpuTime, err := parsePsTime(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stats{
+		RSS:        rss * 1024,
+		CPUPercent: cpuPercent,
+		CPUTime:    cpuTime,
+		State:      State(fields[3][0]),
+	}, nil
+}
+
+// readState reads the run state of the process with the specified pid from
+// ps's state field.
+func readState(pid int) (State, error) {
+	state, err := psField(pid, "state")
+	if err != nil {
+		return 0, err
+	}
+	if state == "" {
+		return 0, ErrProcNotRunning
+	}
+	return State(state[0]), nil
+}
+
+// isZombie always reports false, since finding whether the process with the
+// specified pid is a zombie process requires running ps, which is too slow
+// for HealthCheck to do on every check.
+func isZombie(pid int) bool {
+	return false
+}
+
+// ttyProcessGroups returns the process group id of the process with the
+// specified pid and the foreground process group id of it's controlling tty
+// from a single call to ps. The foreground process group is 0 or -1 if the
+// process doesn't have a controlling tty.
+//
+// The foreground process group can't be read with the TIOCGPGRP ioctl, since
+// that only works for the caller's own controlling tty.
+func ttyProcessGroups(pid int) (pgid, tpgid int, err error) {
+	// ps -o pgid=,tpgid= -p $PID
+	out, err := runOutput("ps", "-o", "pgid=,tpgid=", strconv.Itoa(pid))
+	if err != nil {
+		return 0, 0, ErrProcNotRunning
+	}
+
+	fields := strings.FieldsFunc(string(out), unicode.IsSpace)
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("error: invalid ps process groups for pid %d", pid)
+	}
+	if pgid, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	if tpgid, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	return pgid, tpgid, nil
+}
+
+// readIOStats reads the storage read and write bytes of the process with the
+// specified pid, which is only supported on linux.
+func readIOStats(pid int) (readBytes, writeBytes uint64, err error) {
+	return 0, 0, ErrUnsupported
+}
+
+// startTimeFromPs is true since the start time of a process is only
+// available from ps's lstart field.
+const startTimeFromPs = true
+
+// processStartTime returns the time that the process with the specified pid
+// started, from ps's lstart field.
+func processStartTime(pid int) (time.Time, error) {
+	lstart, err := psField(pid, "lstart")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation(time.ANSIC, lstart, time.Local)
+}
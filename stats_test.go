@@ -0,0 +1,217 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	proc, err := FindByPidFast(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := proc.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.RSS == 0 {
+		t.Error("expected proc rss to be non-zero")
+	}
+
+	if stats.State != StateRunning && stats.State != StateSleeping {
+		t.Errorf("expected proc state to be running or sleeping, found %s", stats.State)
+	}
+}
+
+func TestStateNoPs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("State only avoids ps on linux")
+	}
+
+	// Fail the test if State runs ps, since it's read from /proc on linux.
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		t.Errorf("expected State not to run %s %v", name, arg)
+		return exec.Command(name, arg...)
+	}
+	defer func() { execCommand = exec.Command }()
+
+	proc := &Process{Process: &os.Process{Pid: os.Getpid()}}
+	state, err := proc.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != StateRunning && state != StateSleeping {
+		t.Errorf("proc state incorrect, expected running or sleeping, found %s", state)
+	}
+	if err := proc.HealthCheck(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParsePsTime(t *testing.T) {
+	tests := []struct {
+		in string
+		d  time.Duration
+	}{
+		{"00:00:00", 0},
+		{"00:01:02", time.Minute + 2*time.Second},
+		{"1-02:03:04", 26*time.Hour + 3*time.Minute + 4*time.Second},
+		{"0:01.50", 1500 * time.Millisecond},
+		{"12:34.00", 12*time.Minute + 34*time.Second},
+	}
+
+	for _, test := range tests {
+		d, err := parsePsTime(test.in)
+		if err != nil {
+			t.Errorf("parsePsTime(%q) error: %v", test.in, err)
+			continue
+		}
+		if d != test.d {
+			t.Errorf("parsePsTime(%q) incorrect, expected %s, found %s", test.in, test.d, d)
+		}
+	}
+}
+
+func TestWatchMemory(t *testing.T) {
+	const limit = 32 << 20
+
+	proc := helperProcess(os.Args[0], "grow", "64")
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rss, ok := <-proc.WatchMemory(ctx, limit, 10*time.Millisecond)
+	if !ok {
+		t.Fatal("expected an over limit sample before the watch ended")
+	}
+	if rss <= limit {
+		t.Errorf("expected sample to be over %d bytes, found %d", limit, rss)
+	}
+}
+
+func TestWaitMemoryExceeds(t *testing.T) {
+	const limit = 32 << 20
+
+	proc := helperProcess(os.Args[0], "grow", "64")
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := proc.WaitMemoryExceeds(ctx, limit, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if rss, err := proc.MemoryRSS(); err != nil {
+		t.Fatal(err)
+	} else if rss <= limit {
+		t.Errorf("expected rss to be over %d bytes, found %d", limit, rss)
+	}
+}
+
+func TestWaitForIdle(t *testing.T) {
+	const busy = 500 * time.Millisecond
+
+	proc := helperProcess(os.Args[0], "busy", strconv.Itoa(int(busy/time.Millisecond)))
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+	started := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := proc.WaitForIdle(ctx, 20, 300*time.Millisecond, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < busy {
+		t.Errorf("expected WaitForIdle to return after the busy loop, returned after %v", elapsed)
+	}
+
+	proc.Kill()
+	<-proc.Done()
+	err := proc.WaitForIdle(ctx, 20, 300*time.Millisecond, 50*time.Millisecond)
+	if !errors.Is(err, ErrProcNotRunning) {
+		t.Errorf("expected ErrProcNotRunning, found %v", err)
+	}
+}
+
+func TestCPUTime(t *testing.T) {
+	proc := helperProcess(os.Args[0], "busy", "10000")
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	before, err := proc.CPUTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	after, err := proc.CPUTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after <= before {
+		t.Errorf("expected cpu time to increase, found %v then %v", before, after)
+	}
+}
+
+func TestSortByRSS(t *testing.T) {
+	procs := []*Process{
+		{Process: &os.Process{Pid: 1}, RSS: 2048},
+		{Process: &os.Process{Pid: 2}, RSS: 4096},
+		{Process: &os.Process{Pid: 3}, RSS: 1024},
+	}
+
+	sort.Sort(sort.Reverse(ByRSS(procs)))
+
+	for i, pid := range []int{2, 1, 3} {
+		if procs[i].Pid != pid {
+			t.Errorf("proc %d incorrect, expected pid %d, found %d", i, pid, procs[i].Pid)
+		}
+	}
+}
+
+func TestEnforceCPUBudget(t *testing.T) {
+	proc := &Process{Cmd: "sh", Args: []string{"-c", "while :; do :; done"}}
+
+	notify := make(chan struct{})
+	go proc.Start(false, nil, nil, nil, notify)
+	<-notify
+	defer proc.Kill()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := proc.EnforceCPUBudget(ctx, 0.2, 20*time.Millisecond); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, found %v", err)
+	}
+
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("expected proc to be killed")
+	}
+}
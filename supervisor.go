@@ -0,0 +1,153 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrCrashLoop is an error that occurs when supervising a process and the
+// process keeps exiting too soon after being restarted.
+var ErrCrashLoop = fmt.Errorf("error: process is crash looping")
+
+// RestartPolicy describes how a supervised process is restarted after it
+// exits.
+type RestartPolicy struct {
+	// Delay is how long to wait before restarting the process.
+	Delay time.Duration
+
+	// MinUptime is how long the process must run for before exiting for it
+	// not to count as a crash.
+	MinUptime time.Duration
+
+	// MaxCrashes is how many crashes in a row are allowed before giving up
+	// on restarting the process. If MaxCrashes is 0, the process is always
+	// restarted.
+	MaxCrashes int
+}
+
+// SupervisorConfig describes how Supervise runs a process.
+type SupervisorConfig struct {
+	// Stdout and Stderr are used for each started process's stdout and
+	// stderr.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	Restart RestartPolicy
+
+	// HealthProbe, if set, is called with the process every HealthInterval
+	// while it's running. If it returns an error MaxUnhealthy times in a
+	// row, the process is killed and restarted, even though it's still
+	// running. HealthProbe is only used if MaxUnhealthy is greater than 0.
+	HealthProbe  func(*Process) error
+	MaxUnhealthy int
+
+	// HealthInterval is how often HealthProbe is called. If HealthInterval
+	// is 0, DefaultHealthInterval is used.
+	HealthInterval time.Duration
+}
+
+// DefaultHealthInterval is how often a supervised process's health is probed
+// when SupervisorConfig.HealthInterval isn't set.
+const DefaultHealthInterval = time.Second
+
+// Supervise starts the process and restarts it every time it exits, until
+// ctx is done, in which case the process is killed and ctx's error returned.
+//
+// If the process exits sooner than cfg.Restart.MinUptime after being started
+// cfg.Restart.MaxCrashes times in a row, Supervise stops restarting it and
+// returns ErrCrashLoop. If the process can't be started at all, the error
+// from Start is returned.
+//
+// If cfg.HealthProbe fails cfg.MaxUnhealthy times in a row, the process is
+// killed and then restarted the same as if it had exited by itself.
+func (p *Process) Supervise(ctx context.Context, cfg SupervisorConfig) error {
+	interval := cfg.HealthInterval
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+
+	crashes := 0
+	for {
+		notify := make(chan struct{}, 1)
+		errc := make(chan error, 1)
+		started := time.Now()
+		go func() {
+			errc <- p.Start(false, nil, cfg.Stdout, cfg.Stderr, notify)
+		}()
+
+		running, cancelled, err := p.superviseOnce(ctx, cfg, interval, notify, errc)
+		if cancelled {
+			return ctx.Err()
+		}
+
+		// If the process never started, it can't be restarted.
+		if !running {
+			select {
+			case <-notify:
+			default:
+				return err
+			}
+		}
+
+		if time.Since(started) < cfg.Restart.MinUptime {
+			crashes++
+		} else {
+			crashes = 0
+		}
+		if cfg.Restart.MaxCrashes > 0 && crashes >= cfg.Restart.MaxCrashes {
+			return &ProcError{Op: "supervise", Pid: p.Pid, Err: ErrCrashLoop}
+		}
+
+		select {
+		case <-time.After(cfg.Restart.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// superviseOnce waits for a single run of a supervised process to end,
+// probing it's health while it's running. It returns whether the process was
+// seen to start, whether ctx was done first, in which case the process has
+// been killed, and the error from Start.
+func (p *Process) superviseOnce(ctx context.Context, cfg SupervisorConfig,
+	interval time.Duration, notify chan struct{}, errc chan error) (running, cancelled bool, err error) {
+	var ticks <-chan time.Time
+	failures := 0
+	for {
+		select {
+		case err = <-errc:
+			return running, false, err
+		case <-notify:
+			running = true
+			if cfg.HealthProbe != nil && cfg.MaxUnhealthy > 0 {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				ticks = ticker.C
+			}
+		case <-ticks:
+			if cfg.HealthProbe(p) == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			if failures >= cfg.MaxUnhealthy {
+				p.Kill()
+				ticks = nil
+			}
+		case <-ctx.Done():
+			if !running {
+				select {
+				case <-notify:
+				case <-errc:
+					return false, true, nil
+				}
+			}
+			p.Kill()
+			<-errc
+			return true, true, nil
+		}
+	}
+}
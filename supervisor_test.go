@@ -0,0 +1,65 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSuperviseCrashLoop(t *testing.T) {
+	proc := &Process{Cmd: "true"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := proc.Supervise(ctx, SupervisorConfig{
+		Restart: RestartPolicy{
+			MinUptime:  time.Second,
+			MaxCrashes: 3,
+		},
+	})
+	if !errors.Is(err, ErrCrashLoop) {
+		t.Errorf("expected ErrCrashLoop, found %v", err)
+	}
+}
+
+func TestSuperviseCancel(t *testing.T) {
+	proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := proc.Supervise(ctx, SupervisorConfig{}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, found %v", err)
+	}
+
+	if !proc.Exited() {
+		t.Error("expected supervised process to have exited")
+	}
+}
+
+func TestSuperviseUnhealthy(t *testing.T) {
+	proc := &Process{Cmd: "sleep", Args: []string{"5"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Record every pid the probe sees, which changes on each restart.
+	pids := make(map[int]bool)
+	err := proc.Supervise(ctx, SupervisorConfig{
+		HealthProbe: func(p *Process) error {
+			pids[p.Pid] = true
+			return errors.New("unhealthy")
+		},
+		MaxUnhealthy:   2,
+		HealthInterval: 50 * time.Millisecond,
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, found %v", err)
+	}
+
+	if len(pids) < 2 {
+		t.Errorf("expected unhealthy process to be restarted, probed pids %v", pids)
+	}
+}